@@ -0,0 +1,187 @@
+// Copyright © 2018 Karl Hepworth Karl.Hepworth@gmail.com
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/fubarhouse/ansible-role-tester/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the caches used to speed up repeated runs",
+	Long: `Manage the caches used to speed up repeated runs.
+
+Package caches are volumes created by --package-cache which contain
+the packages downloaded by the package manager of a distribution.
+
+Galaxy caches are created by --galaxy-cache and contain the roles
+and collections of a requirements file. They can be exported to a
+tarball and imported on machines without internet access.
+
+Snapshots are images created by --snapshot of containers which have
+run requirements and prepare.`,
+}
+
+// cacheListCmd represents the cache list command
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the package and galaxy caches and snapshots",
+	Run: func(cmd *cobra.Command, args []string) {
+		volumes, err := util.PackageCacheList()
+		if err != nil {
+			log.Errorf("Could not list package caches: %v", err)
+		}
+		fmt.Println("Package caches:")
+		for _, volume := range volumes {
+			fmt.Printf("  %v\n", volume)
+		}
+
+		caches, err := util.GalaxyCacheList(galaxyCacheDir)
+		if err != nil {
+			log.Errorf("Could not list galaxy caches: %v", err)
+		}
+		dirs := []string{}
+		for dir := range caches {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		fmt.Println("Galaxy caches:")
+		for _, dir := range dirs {
+			fmt.Printf("  %v (%.1f MB)\n", dir, float64(caches[dir])/1024/1024)
+		}
+
+		snapshots, err := util.SnapshotList()
+		if err != nil {
+			log.Errorf("Could not list snapshots: %v", err)
+		}
+		fmt.Println("Snapshots:")
+		for _, snapshot := range snapshots {
+			fmt.Printf("  %v\n", snapshot)
+		}
+	},
+}
+
+// cacheClearCmd represents the cache clear command
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove the package and galaxy caches and snapshots",
+	Long: `Remove the package and galaxy caches and snapshots.
+
+All are removed unless --packages, --galaxy or --snapshots is specified.
+Package caches and snapshots which are in use by a container are not
+removed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		all := !clearPackages && !clearGalaxy && !clearSnapshots
+		failed := false
+
+		if all || clearPackages {
+			if err := util.PackageCacheClear(); err != nil {
+				log.Errorf("Could not clear package caches: %v", err)
+				failed = true
+			} else if !quiet {
+				log.Infoln("Package caches have been cleared")
+			}
+		}
+
+		if all || clearGalaxy {
+			if err := util.GalaxyCacheClear(galaxyCacheDir); err != nil {
+				log.Errorf("Could not clear galaxy caches: %v", err)
+				failed = true
+			} else if !quiet {
+				log.Infof("Galaxy caches in %v have been cleared", galaxyCacheDir)
+			}
+		}
+
+		if all || clearSnapshots {
+			if err := util.SnapshotClear(); err != nil {
+				log.Errorf("Could not clear snapshots: %v", err)
+				failed = true
+			} else if !quiet {
+				log.Infoln("Snapshots have been cleared")
+			}
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var (
+	// clearPackages limits cache clear to package caches.
+	clearPackages = false
+
+	// clearGalaxy limits cache clear to galaxy caches.
+	clearGalaxy = false
+
+	// clearSnapshots limits cache clear to snapshots.
+	clearSnapshots = false
+)
+
+// cacheExportCmd represents the cache export command
+var cacheExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export the galaxy caches to a tarball",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := util.ExportGalaxyCache(galaxyCacheDir, args[0]); err != nil {
+			log.Fatalf("Could not export galaxy cache: %v", err)
+		}
+		if !quiet {
+			log.Infof("Galaxy cache %v has been exported to %v", galaxyCacheDir, args[0])
+		}
+	},
+}
+
+// cacheImportCmd represents the cache import command
+var cacheImportCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import the galaxy caches from a tarball",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := util.ImportGalaxyCache(args[0], galaxyCacheDir); err != nil {
+			log.Fatalf("Could not import galaxy cache: %v", err)
+		}
+		if !quiet {
+			log.Infof("Galaxy cache %v has been imported from %v", galaxyCacheDir, args[0])
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cacheExportCmd)
+	cacheCmd.AddCommand(cacheImportCmd)
+	cacheCmd.PersistentFlags().StringVarP(&galaxyCacheDir, "galaxy-cache-dir", "", util.GalaxyCacheRoot(), "Directory on the host containing the galaxy caches.")
+	cacheClearCmd.Flags().BoolVarP(&clearPackages, "packages", "", false, "Only remove package caches.")
+	cacheClearCmd.Flags().BoolVarP(&clearGalaxy, "galaxy", "", false, "Only remove galaxy caches.")
+	cacheClearCmd.Flags().BoolVarP(&clearSnapshots, "snapshots", "", false, "Only remove snapshots.")
+	cacheCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Enable quiet mode")
+}
@@ -31,23 +31,51 @@ var destroyCmd = &cobra.Command{
 	Use:   "destroy",
 	Short: "Destroys a container with a specified ID",
 	Long: `Destroys a container with a specified ID
+
+The results of run, install and test against the container are
+combined into a single report, which is provided with --report.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		dist, _ := util.GetDistribution(image, image, "/sbin/init", "/sys/fs/cgroup:/sys/fs/cgroup:ro", user, distro)
 		dist.CID = containerID
+
+		report, found, err := util.LoadState(stateDir, dist.CID)
+		if err != nil {
+			log.Warnf("Could not load the state of %v: %v", dist.CID, err)
+		}
+
 		if dist.DockerCheck() {
+			report.StageBegin(util.StageDestroy)
 			dist.DockerKill(quiet)
+			report.Docker.Kill = !dist.DockerCheck()
+			report.StageEnd(report.Docker.Kill)
 		} else {
 			if !quiet {
 				log.Warnf("Container %v is not currently running", dist.CID)
 			}
 		}
+
+		if found {
+			if reportProvided {
+				report.Meta.ReportFile = reportFilename
+				printReport(&report)
+			}
+			if err := util.RemoveState(stateDir, dist.CID); err != nil {
+				log.Warnf("Could not remove the state of %v: %v", dist.CID, err)
+			}
+		} else if reportProvided && !quiet {
+			log.Warnf("No state was found for %v, a report cannot be provided", dist.CID)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(destroyCmd)
 	destroyCmd.Flags().StringVarP(&containerID, "name", "n", "", "Container ID")
+	destroyCmd.Flags().BoolVarP(&reportProvided, "report", "f", false, "Provide a report of the container after it is destroyed")
+	destroyCmd.Flags().StringVarP(&reportFilename, "report-output", "b", "report.yml", "Filename in current working directory to write a report to")
+	destroyCmd.Flags().StringVarP(&reportFormat, "report-format", "", "", "Format of the report: yaml, json, md or html (default from the extension of --report-output).")
+	destroyCmd.Flags().StringVarP(&stateDir, "state-dir", "", util.StateRoot(), "Directory containing the state shared with run, install and test.")
 	destroyCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Enable quiet mode")
 	destroyCmd.MarkFlagRequired("name")
 }
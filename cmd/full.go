@@ -21,13 +21,11 @@
 package cmd
 
 import (
+	"context"
 	"os"
 
-	"fmt"
-	"strings"
-
+	"github.com/fubarhouse/ansible-role-tester/pkg/tester"
 	"github.com/fubarhouse/ansible-role-tester/util"
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -60,111 +58,81 @@ required.
 				LibraryPath:      libraryPath,
 				RequirementsFile: requirements,
 				PlaybookFile:     playbook,
+				PrepareFile:      prepare,
+				Dockerfile:       dockerfile,
+				NetworkMode:      networkMode,
+				PackageCache:     packageCache,
 				Verbose:          verbose,
 				Remote:           remote,
 				Quiet:            quiet,
 			}
 
-			var dist util.Distribution
-
-			if !custom {
-				var e error
-				dist, e = util.GetDistribution(image, image, "/sbin/init", "/sys/fs/cgroup:/sys/fs/cgroup:ro", user, distro)
-				if e != nil && !quiet {
-					log.Fatalln("Incompatible distribution was inputted.")
-				}
-			} else {
-				dist = *util.NewCustomDistribution()
-				user := strings.Split(image, "/")[0]
-				container := strings.Split(image, ":")[0]
-				container = strings.Split(container, "/")[1]
-				tag := strings.Split(image, ":")[1]
-
-				dist.Privileged = true
-				util.CustomDistributionValueSet(&dist, "Name", containerID)
-				//util.CustomValueSet(&dist, "Privileged", "true")
-				util.CustomDistributionValueSet(&dist, "Container", fmt.Sprintf("%s/%s:%s", user, container, tag))
-				util.CustomDistributionValueSet(&dist, "User", user)
-				util.CustomDistributionValueSet(&dist, "Distro", image)
-				util.CustomFamilyValueSet(&dist.Family, "Initialise", initialise)
-				util.CustomFamilyValueSet(&dist.Family, "Volume", volume)
+			if pool {
+				config.Pool = poolSize
 			}
 
-			dist.CID = containerID
-
-			if !config.IsAnsibleRole() {
-				if !quiet {
-					log.Fatalf("Path %v is not recognized as an Ansible role.", config.HostPath)
+			if topology != "" {
+				if !config.IsAnsibleRole() {
+					fatal(util.NotARoleCode, "Path %v is not recognized as an Ansible role.", config.HostPath)
 				}
-				os.Exit(util.NotARoleCode)
+				report = fullTopology(&config)
+				return
 			}
 
-			util.MapInventory(dist.CID, &config)
-			util.MapRequirements(&config)
-			util.MapPlaybook(&config)
-
-			report = util.NewReport(&config)
-			report.Meta.ReportFile = reportFilename
-			report.Ansible.Distribution = dist
-
-			if !dist.DockerCheck() {
-				dist.DockerRun(&config, &report)
-				report.Docker.Run = dist.DockerCheck()
+			options := tester.Options{
+				Config:           config,
+				Name:             containerID,
+				Image:            image,
+				User:             user,
+				Distribution:     distro,
+				Custom:           custom,
+				Pull:             pullPolicy,
+				Digest:           digest,
+				Mirror:           mirror,
+				CredentialHelper: credentialHelper,
+				GalaxyCache:      galaxyCache,
+				GalaxyCacheDir:   galaxyCacheDir,
+				Snapshot:         snapshot,
+				Sidecars:         sourcePath(sidecarsFile),
+				Fixtures:         sourcePath(fixtures),
+				FixturesPort:     fixturesPort,
+				FixtureHosts:     fixtureHosts,
+				Stages:           stageNames,
+				FromStage:        fromStage,
+				Resume:           resume,
+				Keep:             keep,
+				Artifacts:        artifacts,
+				DryRun:           dryRun,
 			}
-			hosts, _ := dist.AnsibleHosts(&config, &report)
-			report.Ansible.Hosts = hosts
-			if remote {
-				for _, host := range hosts {
-					if host == "localhost" {
-						log.Errorln("remote runs should be run directly, not through this tool")
-						dist.DockerKill(quiet)
-					}
-				}
+			if custom || cmd.Flags().Changed("initialise") {
+				options.Initialise = initialise
 			}
-
-			report.Ansible.Requirements = dist.RoleInstall(&config)
-			if !remote {
-				report.Ansible.Syntax = dist.RoleSyntaxCheck(&config)
-				if report.Ansible.Syntax {
-					report.Ansible.Run.Result, report.Ansible.Run.Time = dist.RoleTest(&config)
-				}
-				if report.Ansible.Run.Result {
-					report.Ansible.Idempotence.Result, report.Ansible.Idempotence.Time = dist.IdempotenceTest(&config)
-				}
-			} else {
-				report.Ansible.Syntax = dist.RoleSyntaxCheckRemote(&config)
-				if report.Ansible.Syntax {
-					report.Ansible.Run.Result, report.Ansible.Run.Time = dist.RoleTestRemote(&config)
-				}
-				if report.Ansible.Run.Result {
-					report.Ansible.Idempotence.Result, report.Ansible.Idempotence.Time = dist.IdempotenceTestRemote(&config)
-				}
+			if custom || cmd.Flags().Changed("volume") {
+				options.Volume = volume
+			}
+			if tap != nil {
+				options.Listener = tap
 			}
 
-			dist.DockerKill(quiet)
-			if !dist.DockerCheck() {
-				report.Docker.Kill = true
+			result, err := tester.New(options).Run(context.Background())
+			if err != nil {
+				if e, ok := err.(*tester.Error); ok {
+					fatal(e.Code, "%v", err)
+				}
+				fatal(1, "%v", err)
 			}
 
+			report = result.Report
+			config = report.Ansible.Config
 			if reportProvided {
-				report.Ansible.Config = config
-				report.Printf()
+				report.Meta.ReportFile = reportFilename
+				printReport(&report)
 			}
 		},
 		// Analyze report and return the proper exit code.
 		PostRun: func(cmd *cobra.Command, args []string) {
-			// fmt.Println("PostRun called")
-			if !report.Docker.Run {
-				os.Exit(util.DockerRunCode)
-			} else if !report.Ansible.Syntax {
-				os.Exit(util.AnsibleSyntaxCode)
-			} else if !report.Ansible.Run.Result {
-				os.Exit(util.AnsibleRunCode)
-			} else if !report.Ansible.Idempotence.Result {
-				os.Exit(util.AnsibleIdempotenceCode)
-			} else {
-				os.Exit(util.OKCode)
-			}
+			endTAP()
+			os.Exit(tester.ExitCode(&report))
 		},
 	}
 }
@@ -184,7 +152,32 @@ func addFullFlags(fullCmd *cobra.Command, dir string) {
 	fullCmd.Flags().BoolVarP(&remote, "remote", "m", false, "Run the test remotely to the container")
 	fullCmd.Flags().BoolVarP(&reportProvided, "report", "f", false, "Provide a report after completion")
 	fullCmd.Flags().StringVarP(&reportFilename, "report-output", "b", "report.yml", "Filename in current working directory to write a report to")
+	fullCmd.Flags().StringVarP(&reportFormat, "report-format", "", "", "Format of the report: yaml, json, md or html (default from the extension of --report-output).")
 	fullCmd.Flags().StringVarP(&libraryPath, "library", "", "", "Path to library folder with modules.")
+	fullCmd.Flags().StringVarP(&pullPolicy, "pull", "", util.PullMissing, "Image pull policy: always, missing or never.")
+	fullCmd.Flags().StringVarP(&mirror, "mirror", "", os.Getenv(util.MirrorEnv), "Registry to pull images from in place of their origin.")
+	fullCmd.Flags().StringVarP(&credentialHelper, "credential-helper", "", "", "Docker credential helper used to authenticate to the image registry (ie ecr-login).")
+	fullCmd.Flags().StringVarP(&digest, "digest", "", "", "Pin the selected image to a digest (ie sha256:...).")
+	fullCmd.Flags().StringVarP(&dockerfile, "dockerfile", "", "", "Path to a Dockerfile to build the test image from (default tests/Dockerfile if present).")
+
+	fullCmd.Flags().StringSliceVarP(&stageNames, "stages", "", []string{}, "Stages to run: requirements, prepare, syntax, converge and idempotence (default all).")
+	fullCmd.Flags().StringVarP(&fromStage, "from-stage", "", "", "Stage to start from, skipping the stages before it.")
+	fullCmd.Flags().BoolVarP(&resume, "resume", "", false, "Start after the last stage which completed on a running container.")
+	fullCmd.Flags().BoolVarP(&keep, "keep", "", false, "Keep the container after the test has completed.")
+	fullCmd.Flags().StringVarP(&artifacts, "artifacts", "", "", "Directory to write the output of each stage to, in a directory for the run.")
+	fullCmd.Flags().StringVarP(&prepare, "prepare", "", "", "The filename of a playbook which prepares the container before testing.")
+	fullCmd.Flags().BoolVarP(&snapshot, "snapshot", "", false, "Snapshot the container after requirements and prepare, and reuse it while they are unchanged.")
+	fullCmd.Flags().StringVarP(&topology, "topology", "", "", "Path to a topology file declaring several instances to test together.")
+	fullCmd.Flags().BoolVarP(&pool, "pool", "", false, "Take the container from a pool of started containers, and replace it in the background.")
+	fullCmd.Flags().IntVarP(&poolSize, "pool-size", "", 2, "Number of started containers to keep in the pool.")
+	fullCmd.Flags().StringVarP(&networkMode, "network", "", "", "Isolate the container from external networks: none or internal.")
+	fullCmd.Flags().StringVarP(&sidecarsFile, "sidecars", "", "", "Path to a file declaring sidecar containers to start alongside the container.")
+	fullCmd.Flags().StringVarP(&fixtures, "fixtures", "", "", "Path to a directory of fixtures to serve over HTTP to the container (ie tests/fixtures).")
+	fullCmd.Flags().IntVarP(&fixturesPort, "fixtures-port", "", 0, "Port on the host to serve fixtures on (default an ephemeral port).")
+	fullCmd.Flags().StringSliceVarP(&fixtureHosts, "fixture-host", "", []string{}, "Hostname which resolves to the fixture server in the container, may be repeated.")
+	fullCmd.Flags().BoolVarP(&packageCache, "package-cache", "", false, "Persist the package manager cache in volumes between containers.")
+	fullCmd.Flags().BoolVarP(&galaxyCache, "galaxy-cache", "", false, "Install requirements into a cache on the host which is reused by later runs.")
+	fullCmd.Flags().StringVarP(&galaxyCacheDir, "galaxy-cache-dir", "", util.GalaxyCacheRoot(), "Directory on the host containing the galaxy caches.")
 
 	fullCmd.Flags().StringVarP(&initialise, "initialise", "a", "/bin/systemd", "The initialise command for the image")
 	fullCmd.Flags().StringVarP(&volume, "volume", "l", "/sys/fs/cgroup:/sys/fs/cgroup:ro", "The volume argument for the image")
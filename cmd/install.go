@@ -47,7 +47,7 @@ var installCmd = &cobra.Command{
 
 		dist, e := util.GetDistribution(image, image, "/sbin/init", "/sys/fs/cgroup:/sys/fs/cgroup:ro", user, distro)
 		if e != nil && !quiet {
-			log.Fatalln("Incompatible distribution was inputted.")
+			log.Fatalf("Incompatible distribution was inputted: %v", e)
 		}
 
 		dist.CID = containerID
@@ -57,10 +57,22 @@ var installCmd = &cobra.Command{
 		}
 		if dist.DockerCheck() {
 
-			util.MapInventory(dist.CID, &config)
-			util.MapRequirements(&config)
+			if galaxyCache {
+				if err := util.PrepareGalaxyCache(&config, galaxyCacheDir); err != nil {
+					log.Fatalln(err)
+				}
+			}
+
+			if err := util.MapInventory(dist.CID, &config); err != nil {
+				log.Fatalln(err)
+			}
+			if err := util.MapRequirements(&config); err != nil {
+				log.Fatalln(err)
+			}
 
-			dist.RoleInstall(&config)
+			report := loadState(&config, &dist)
+			report.Ansible.Requirements = dist.RoleInstall(&config)
+			saveState(&dist, &report)
 
 		} else {
 			if !quiet {
@@ -76,6 +88,9 @@ func init() {
 	installCmd.Flags().StringVarP(&containerID, "name", "n", containerID, "Container ID")
 	installCmd.Flags().StringVarP(&inventory, "inventory", "e", "", "Inventory file")
 	installCmd.Flags().StringVarP(&requirements, "requirements", "r", "", "Path to requirements file.")
+	installCmd.Flags().BoolVarP(&galaxyCache, "galaxy-cache", "", false, "Install requirements into the cache mounted with run --galaxy-cache.")
+	installCmd.Flags().StringVarP(&galaxyCacheDir, "galaxy-cache-dir", "", util.GalaxyCacheRoot(), "Directory on the host containing the galaxy caches.")
+	installCmd.Flags().StringVarP(&stateDir, "state-dir", "", util.StateRoot(), "Directory containing the state shared with run, test and destroy.")
 	installCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Enable quiet mode")
 	installCmd.Flags().StringVarP(&source, "source", "s", pwd, "Location of the role to test")
 	installCmd.MarkFlagRequired("name")
@@ -0,0 +1,84 @@
+// Copyright © 2018 Karl Hepworth Karl.Hepworth@gmail.com
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fubarhouse/ansible-role-tester/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// mirrorCmd represents the mirror command
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Copy the images of a matrix of distributions to a local registry",
+	Long: `Copy the images of a matrix of distributions to a local registry.
+
+Each image is pulled from its origin, tagged and pushed to the
+registry specified with --mirror. Once mirrored, commands run
+with the same --mirror (or $ANSIBLE_ROLE_TESTER_MIRROR) will
+pull images from the mirror, so no internet access is needed.
+
+The matrix is selected with --users and --distributions, and
+every known distribution will be mirrored when neither is provided.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if mirror == "" {
+			log.Fatalf("A mirror registry must be specified with --mirror or $%v.", util.MirrorEnv)
+		}
+
+		images := util.DistributionImages(util.FilterDistributions(users, distros))
+		if len(images) == 0 {
+			log.Fatalln("No distributions matched the specified users and distributions.")
+		}
+
+		if !quiet {
+			log.Infof("Mirroring %v images to %v with %v parallel copies", len(images), mirror, parallel)
+		}
+
+		util.CredentialHelper = credentialHelper
+		failed := false
+		for _, result := range util.DockerMirrorAll(images, mirror, parallel) {
+			if result.Error != nil {
+				failed = true
+				log.Errorln(result.Error)
+				continue
+			}
+			fmt.Printf("%v@%v\n", result.Image, result.Digest)
+		}
+
+		if failed {
+			os.Exit(util.DockerRunCode)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mirrorCmd)
+	mirrorCmd.Flags().StringVarP(&mirror, "mirror", "", os.Getenv(util.MirrorEnv), "Registry to copy the images to (ie registry.local:5000).")
+	mirrorCmd.Flags().StringSliceVarP(&users, "users", "u", []string{}, "Users of the distributions to mirror (default all).")
+	mirrorCmd.Flags().StringSliceVarP(&distros, "distributions", "t", []string{}, "Distributions to mirror (default all).")
+	mirrorCmd.Flags().IntVarP(&parallel, "parallel", "j", 4, "Number of images to copy in parallel.")
+	mirrorCmd.Flags().StringVarP(&credentialHelper, "credential-helper", "", "", "Docker credential helper used to authenticate to the registries (ie ecr-login).")
+	mirrorCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Enable quiet mode")
+}
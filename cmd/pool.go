@@ -0,0 +1,72 @@
+// Copyright © 2018 Karl Hepworth Karl.Hepworth@gmail.com
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fubarhouse/ansible-role-tester/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// poolCmd represents the pool command
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Manage the pool of started containers",
+	Long: `Manage the pool of started containers.
+
+Containers are added to the pool by full and run when --pool is
+specified, and are taken from it by later runs which use the same
+image and configuration.`,
+}
+
+// poolListCmd represents the pool list command
+var poolListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the containers waiting in the pool",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, name := range util.PoolList() {
+			fmt.Println(name)
+		}
+	},
+}
+
+// poolDrainCmd represents the pool drain command
+var poolDrainCmd = &cobra.Command{
+	Use:   "drain",
+	Short: "Remove the containers waiting in the pool",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := util.PoolDrain(); err != nil {
+			log.Fatalf("Could not drain the pool: %v", err)
+		}
+		if !quiet {
+			log.Infoln("The pool has been drained")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(poolCmd)
+	poolCmd.AddCommand(poolListCmd)
+	poolCmd.AddCommand(poolDrainCmd)
+	poolCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Enable quiet mode")
+}
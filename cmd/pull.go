@@ -0,0 +1,97 @@
+// Copyright © 2018 Karl Hepworth Karl.Hepworth@gmail.com
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fubarhouse/ansible-role-tester/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// pullCmd represents the pull command
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Pre-fetch the images of a matrix of distributions",
+	Long: `Pre-fetch the images of a matrix of distributions in parallel.
+
+The matrix is selected with --users and --distributions, and
+every known distribution will be pulled when neither is provided.
+Distributions which are pinned to a digest are pulled by digest.
+The resolved digest of each image is printed on completion, which
+can be used with the --digest flag to pin an image.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dists := util.FilterDistributions(users, distros)
+		for i := range dists {
+			if dists[i].Digest != "" {
+				if err := dists[i].PinDigest(dists[i].Digest); err != nil {
+					log.Fatalf("Could not pin image to digest: %v", err)
+				}
+			}
+		}
+
+		images := util.DistributionImages(dists)
+		if len(images) == 0 {
+			log.Fatalln("No distributions matched the specified users and distributions.")
+		}
+
+		if mirror != "" {
+			for i, image := range images {
+				mirrored, err := util.MirrorImage(image, mirror)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				images[i] = mirrored
+			}
+		}
+
+		if !quiet {
+			log.Infof("Pulling %v images with %v parallel pulls", len(images), parallel)
+		}
+
+		util.CredentialHelper = credentialHelper
+		failed := false
+		for _, result := range util.DockerPullAll(images, parallel) {
+			if result.Error != nil {
+				failed = true
+				log.Errorln(result.Error)
+				continue
+			}
+			fmt.Printf("%v@%v\n", result.Image, result.Digest)
+		}
+
+		if failed {
+			os.Exit(util.DockerRunCode)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+	pullCmd.Flags().StringSliceVarP(&users, "users", "u", []string{}, "Users of the distributions to pull (default all).")
+	pullCmd.Flags().StringSliceVarP(&distros, "distributions", "t", []string{}, "Distributions to pull (default all).")
+	pullCmd.Flags().IntVarP(&parallel, "parallel", "j", 4, "Number of images to pull in parallel.")
+	pullCmd.Flags().StringVarP(&mirror, "mirror", "", os.Getenv(util.MirrorEnv), "Registry to pull images from in place of their origin.")
+	pullCmd.Flags().StringVarP(&credentialHelper, "credential-helper", "", "", "Docker credential helper used to authenticate to the image registry (ie ecr-login).")
+	pullCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Enable quiet mode")
+}
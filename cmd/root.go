@@ -22,7 +22,12 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/fubarhouse/ansible-role-tester/util"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -61,6 +66,21 @@ var (
 	// the 'tests' folder.
 	playbook string
 
+	// prepare is the path to a playbook which prepares the container
+	// after requirements are installed, before the role is tested.
+	prepare string
+
+	// snapshot indicates the container should be snapshotted after
+	// requirements and prepare, and the snapshot reused by later runs.
+	snapshot = false
+
+	// pool indicates containers should be taken from, and
+	// replaced in, a pool of containers which have been started.
+	pool = false
+
+	// poolSize is the number of containers kept in the pool.
+	poolSize int
+
 	// libraryPath is an optional argument for binding a
 	// host folder with ansible modules into the container
 	libraryPath string
@@ -93,14 +113,125 @@ var (
 	reportProvided = false
 
 	// reportFilename is the relative path of a file in the working directory
-	// to write a file to. The file extension should match json|yml|yaml or else
-	// will not work, but will automatically handle as necessary.
+	// to write a file to. The file extension should match json|yml|yaml|html|md
+	// unless reportFormat is provided.
 	reportFilename string
 
+	// reportFormat is the format the report is written in, which is
+	// taken from the extension of reportFilename when empty.
+	reportFormat string
+
 	// verbose is a boolean indicating all Ansible commands should
 	// be dockerRun with the --verbose flag.
 	verbose = false
 
+	// dockerfile is the path to a Dockerfile relative to source which
+	// will be built and used in place of the distribution image.
+	dockerfile string
+
+	// pullPolicy is the policy for pulling the image before
+	// starting a container, which is one of always|missing|never.
+	pullPolicy string
+
+	// credentialHelper is the name of a Docker credential helper
+	// used to authenticate against private registries.
+	credentialHelper string
+
+	// digest is an optional digest to pin the selected image to.
+	digest string
+
+	// mirror is the registry which images will be pulled from
+	// in place of their origin, for use without internet access.
+	mirror string
+
+	// galaxyCache indicates requirements should be installed into
+	// and used from a cache on the host keyed by their contents.
+	galaxyCache = false
+
+	// galaxyCacheDir is the directory on the host containing the galaxy caches.
+	galaxyCacheDir string
+
+	// topology is the path to a topology file declaring several
+	// instances to be tested together, relative to source.
+	topology string
+
+	// sidecarsFile is the path to a file declaring sidecar containers
+	// to start alongside the container under test, relative to source.
+	sidecarsFile string
+
+	// fixtures is the path to a directory relative to source which
+	// is served over HTTP from the host to the container.
+	fixtures string
+
+	// fixturesPort is the port on the host the fixtures are served on.
+	fixturesPort int
+
+	// fixtureHosts are hostnames which will resolve to the
+	// fixture server from inside of the container.
+	fixtureHosts []string
+
+	// networkMode is the network isolation of the container,
+	// which is either none or internal when configured.
+	networkMode string
+
+	// packageCache indicates package manager caches should be
+	// persisted in volumes between containers.
+	packageCache = false
+
+	// users is a list of users used to select a matrix of
+	// distributions for commands operating on many images.
+	users []string
+
+	// distros is a list of distributions used to select a matrix of
+	// distributions for commands operating on many images.
+	distros []string
+
+	// parallel is the number of concurrent operations for
+	// commands operating on many images.
+	parallel int
+
+	// stageNames is the list of stages to run, all stages
+	// are run when it is empty.
+	stageNames []string
+
+	// fromStage is the stage to start from, skipping those before it.
+	fromStage string
+
+	// resume indicates the stages should start after the last
+	// stage which completed on the container.
+	resume = false
+
+	// keep indicates the container should not be removed
+	// after the test has completed.
+	keep = false
+
+	// artifacts is the directory the output of each stage is written to.
+	artifacts string
+
+	// stateDir is the directory containing the state of containers
+	// which is shared by the run, install, test and destroy commands.
+	stateDir string
+
+	// dryRun indicates commands should be printed instead of run.
+	dryRun = false
+
+	// planFormat is the format commands are printed in when dry running.
+	planFormat string
+
+	// record is the path of a transcript to record commands to.
+	record string
+
+	// replay is the path of a transcript to replay commands from.
+	replay string
+
+	// format is the format results are written to the console in,
+	// which is either text or tap.
+	format string
+
+	// tap writes the result of each stage as it completes
+	// when the format is tap.
+	tap *util.TAPWriter
+
 	// volume is the initialisation command for custom distributions
 	volume string
 
@@ -112,9 +243,184 @@ var (
 		Use:   "ansible-test",
 		Short: "Run an Ansible role for testing purposes in an isolated environment.",
 		Long:  ``,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if reportFormat != "" && !validReportFormat(reportFormat) {
+				log.Fatalf("unknown report format %v, expected one of %v", reportFormat, strings.Join(util.ReportFormats, ", "))
+			}
+			if dryRun && (record != "" || replay != "") {
+				log.Fatalln("--dry-run cannot be used with --record or --replay")
+			}
+			switch format {
+			case formatText:
+			case formatTAP:
+				if dryRun {
+					log.Fatalln("--format tap cannot be used with --dry-run")
+				}
+				// Command output is moved to stderr so stdout is only TAP.
+				tap = util.NewTAPWriter(os.Stdout)
+				util.Listener = tap
+				util.CommandStdout = os.Stderr
+			default:
+				log.Fatalf("unknown format %v, expected text or tap", format)
+			}
+			if replay != "" {
+				executor, err := util.NewReplayExecutor(replay)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				util.CommandExecutor = executor
+				return
+			}
+			if record != "" {
+				executor, err := util.NewRecordingExecutor(util.CommandExecutor, record)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				util.CommandExecutor = executor
+			}
+			if dryRun {
+				executor, err := util.NewPlanExecutor(os.Stdout, planFormat)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				// These commands operate on a container started earlier.
+				switch cmd.Name() {
+				case "install", "test", "destroy", "shell":
+					executor.Started(containerID)
+				}
+				util.CommandExecutor = executor
+				log.SetLevel(log.ErrorLevel)
+				return
+			}
+			if err := util.CheckDocker(); err != nil {
+				log.Fatalln(err)
+			}
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			endTAP()
+		},
 	}
 )
 
+const (
+	// formatText writes results to the console as text.
+	formatText = "text"
+
+	// formatTAP writes results to the console in the Test Anything Protocol.
+	formatTAP = "tap"
+)
+
+// sourcePath returns the path to a file which may be relative
+// to the role, falling back to the path as it was provided.
+func sourcePath(path string) string {
+	if path != "" && !filepath.IsAbs(path) {
+		if _, err := os.Stat(filepath.Join(source, path)); err == nil {
+			return filepath.Join(source, path)
+		}
+	}
+	return path
+}
+
+// stageSelection returns the stages to run against the container from
+// the stages the command can run, starting after the last completed
+// stage when resuming.
+func stageSelection(dist *util.Distribution, stages []string) map[string]bool {
+	if !resume {
+		selected, err := util.SelectStagesOf(stages, stageNames, fromStage)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return selected
+	}
+
+	completed := dist.StageCompleted()
+	selected, err := util.ResumeStages(stages, stageNames, completed)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if !quiet {
+		if len(selected) == 0 {
+			log.Infof("All stages have completed on %v", dist.CID)
+		} else if completed != "" {
+			log.Infof("Resuming %v after the %v stage", dist.CID, completed)
+		}
+	}
+	return selected
+}
+
+// printReport prints the report and writes it to the report file,
+// only writing the file when results are written as TAP.
+func printReport(report *util.AnsibleReport) {
+	report.Meta.ReportFormat = reportFormat
+	if tap != nil {
+		report.WriteFile()
+		return
+	}
+	report.Printf()
+}
+
+// validReportFormat will identify if the format is one of util.ReportFormats.
+func validReportFormat(format string) bool {
+	for _, f := range util.ReportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// fatal will log the error, bailing out of TAP output, and exit with the code.
+func fatal(code int, format string, args ...interface{}) {
+	err := fmt.Errorf(format, args...)
+	log.Errorln(err)
+	if tap != nil {
+		tap.BailOut(err)
+	}
+	endTAP()
+	os.Exit(code)
+}
+
+// endTAP writes the plan when results are written as TAP. It is
+// called before exiting, as the PersistentPostRun will not run.
+func endTAP() {
+	if tap != nil {
+		tap.End()
+		tap = nil
+	}
+}
+
+// loadState returns the report persisted for the container, or
+// a new report for the configuration when there is none.
+func loadState(config *util.AnsibleConfig, dist *util.Distribution) util.AnsibleReport {
+	report, found, err := util.LoadState(stateDir, dist.CID)
+	if err != nil {
+		log.Warnf("Could not load the state of %v: %v", dist.CID, err)
+	}
+	if !found {
+		report = util.NewReport(config)
+		report.Ansible.Distribution = *dist
+	}
+	return report
+}
+
+// saveState persists the report for the container.
+func saveState(dist *util.Distribution, report *util.AnsibleReport) {
+	if dryRun {
+		return
+	}
+	if err := util.SaveState(stateDir, dist.CID, report); err != nil {
+		log.Warnf("Could not save the state of %v: %v", dist.CID, err)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "Print the docker and ansible commands which would run instead of running them.")
+	rootCmd.PersistentFlags().StringVarP(&record, "record", "", "", "Record every command which runs, with its output, to a transcript file.")
+	rootCmd.PersistentFlags().StringVarP(&replay, "replay", "", "", "Replay the output of commands from a transcript file instead of running them.")
+	rootCmd.PersistentFlags().StringVarP(&planFormat, "plan-format", "", util.PlanText, "Format of the commands printed by --dry-run: text or json.")
+	rootCmd.PersistentFlags().StringVarP(&format, "format", "", formatText, "Format of the results on the console: text, or tap to write each stage as it completes.")
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -23,9 +23,6 @@ package cmd
 import (
 	"os"
 
-	"fmt"
-	"strings"
-
 	"github.com/fubarhouse/ansible-role-tester/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -53,37 +50,79 @@ Volume mount locations image and id are all configurable.
 				LibraryPath:      libraryPath,
 				RequirementsFile: requirements,
 				PlaybookFile:     playbook,
+				Dockerfile:       dockerfile,
+				NetworkMode:      networkMode,
+				PackageCache:     packageCache,
 				Verbose:          verbose,
 				Remote:           remote,
 				Quiet:            quiet,
 			}
 
+			if pool {
+				config.Pool = poolSize
+			}
+
 			var dist util.Distribution
 
 			if !custom {
 				var e error
 				dist, e = util.GetDistribution(image, image, "/sbin/init", "/sys/fs/cgroup:/sys/fs/cgroup:ro", user, distro)
 				if e != nil {
-					log.Fatalln("Incompatible distribution was inputted.")
+					log.Fatalf("Incompatible distribution was inputted: %v", e)
 				}
 			} else {
 				dist = *util.NewCustomDistribution()
-				user := strings.Split(image, "/")[0]
-				container := strings.Split(image, ":")[0]
-				container = strings.Split(container, "/")[1]
-				tag := strings.Split(image, ":")[1]
+				ref, err := util.ParseImageReference(image)
+				if err != nil {
+					log.Fatalf("Invalid custom image: %v", err)
+				}
 
 				dist.Privileged = true
 				util.CustomDistributionValueSet(&dist, "Name", containerID)
 				//util.CustomValueSet(&dist, "Privileged", "true")
-				util.CustomDistributionValueSet(&dist, "Container", fmt.Sprintf("%s/%s:%s", user, container, tag))
-				util.CustomDistributionValueSet(&dist, "User", user)
+				util.CustomDistributionValueSet(&dist, "Container", ref.String())
+				util.CustomDistributionValueSet(&dist, "User", ref.Namespace)
 				util.CustomDistributionValueSet(&dist, "Distro", image)
 				util.CustomFamilyValueSet(&dist.Family, "Initialise", initialise)
 				util.CustomFamilyValueSet(&dist.Family, "Volume", volume)
 			}
 
 			dist.CID = containerID
+			util.CredentialHelper = credentialHelper
+
+			if config.DockerfilePath() != "" {
+				if cmd.Flags().Changed("initialise") {
+					dist.Family.Initialise = initialise
+				}
+				if cmd.Flags().Changed("volume") {
+					dist.Family.Volume = volume
+				}
+				if err := dist.DockerBuild(&config, pullPolicy, mirror); err != nil {
+					if util.IsRegistryAuthError(err) {
+						log.Errorln(err)
+						os.Exit(util.RegistryAuthCode)
+					}
+					log.Fatalln(err)
+				}
+			} else {
+				if mirror != "" {
+					if err := dist.UseMirror(mirror); err != nil {
+						log.Fatalln(err)
+					}
+				}
+				if digest != "" {
+					if err := dist.PinDigest(digest); err != nil {
+						log.Fatalf("Could not pin image to digest: %v", err)
+					}
+				}
+				if err := dist.DockerPull(pullPolicy, quiet); err != nil {
+					if util.IsRegistryAuthError(err) {
+						log.Errorln(err)
+						os.Exit(util.RegistryAuthCode)
+					}
+					log.Fatalln(err)
+				}
+			}
 
 			if !config.IsAnsibleRole() && !quiet {
 				log.Fatalf("Path %v is not recognized as an Ansible role.", config.HostPath)
@@ -98,12 +137,54 @@ Volume mount locations image and id are all configurable.
 				}
 			}
 
-			util.MapInventory(dist.CID, &config)
-			// Our report variable is needed, but unused.
-			report = util.AnsibleReport{}
+			if galaxyCache {
+				if err := util.PrepareGalaxyCache(&config, galaxyCacheDir); err != nil {
+					log.Fatalln(err)
+				}
+			}
+
+			if err := util.MapInventory(dist.CID, &config); err != nil {
+				log.Fatalln(err)
+			}
+
+			report = util.NewReport(&config)
+			report.Ansible.Distribution = dist
+			report.Docker.Pull = pullPolicy
+			report.Docker.Network = config.NetworkName()
 
 			if !dist.DockerCheck() {
+				if err := dist.NetworkPrepare(&config); err != nil {
+					log.Errorln(err)
+					dist.DockerKill(quiet)
+					os.Exit(util.DockerRunCode)
+				}
+				if sidecarsFile != "" {
+					sidecars, err := util.LoadSidecars(sourcePath(sidecarsFile))
+					if err != nil {
+						log.Fatalln(err)
+					}
+					if mirror != "" {
+						if err := util.UseMirrorSidecars(sidecars, mirror); err != nil {
+							log.Fatalln(err)
+						}
+					}
+					if err := dist.SidecarsRun(&config, &report, sidecars, pullPolicy); err != nil {
+						log.Errorln(err)
+						dist.DockerKill(quiet)
+						if util.IsRegistryAuthError(err) {
+							os.Exit(util.RegistryAuthCode)
+						}
+						os.Exit(util.DockerRunCode)
+					}
+				}
+				report.StageBegin(util.StageStart)
 				report.Docker.Run = dist.DockerRun(&config, &report)
+				report.StageEnd(report.Docker.Run)
+				if report.Docker.Run {
+					report.Docker.Digest, _ = util.ImageDigest(dist.Container)
+					dist.DetectEnvironment(&config, &report)
+					saveState(&dist, &report)
+				}
 			} else {
 				if !quiet {
 					log.Warnf("Container %v is already running", dist.CID)
@@ -113,6 +194,7 @@ Volume mount locations image and id are all configurable.
 		},
 		// Analyze report and return the proper exit code.
 		PostRun: func(cmd *cobra.Command, args []string) {
+			endTAP()
 			if !report.Docker.Run {
 				os.Exit(util.DockerRunCode)
 			} else {
@@ -132,6 +214,21 @@ func addRunFlags(runCmd *cobra.Command, dir string) {
 	runCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Enable quiet mode")
 	runCmd.Flags().BoolVarP(&remote, "remote", "m", false, "Run the test remotely to the container")
 	runCmd.Flags().StringVarP(&libraryPath, "library", "", "", "Path to library folder with modules.")
+	runCmd.Flags().StringVarP(&pullPolicy, "pull", "", util.PullMissing, "Image pull policy: always, missing or never.")
+	runCmd.Flags().StringVarP(&mirror, "mirror", "", os.Getenv(util.MirrorEnv), "Registry to pull images from in place of their origin.")
+	runCmd.Flags().StringVarP(&credentialHelper, "credential-helper", "", "", "Docker credential helper used to authenticate to the image registry (ie ecr-login).")
+	runCmd.Flags().StringVarP(&digest, "digest", "", "", "Pin the selected image to a digest (ie sha256:...).")
+	runCmd.Flags().StringVarP(&dockerfile, "dockerfile", "", "", "Path to a Dockerfile to build the test image from (default tests/Dockerfile if present).")
+
+	runCmd.Flags().StringVarP(&requirements, "requirements", "r", "", "Path to requirements file.")
+	runCmd.Flags().StringVarP(&stateDir, "state-dir", "", util.StateRoot(), "Directory containing the state shared with install, test and destroy.")
+	runCmd.Flags().BoolVarP(&pool, "pool", "", false, "Take the container from a pool of started containers, and replace it in the background.")
+	runCmd.Flags().IntVarP(&poolSize, "pool-size", "", 2, "Number of started containers to keep in the pool.")
+	runCmd.Flags().StringVarP(&networkMode, "network", "", "", "Isolate the container from external networks: none or internal.")
+	runCmd.Flags().StringVarP(&sidecarsFile, "sidecars", "", "", "Path to a file declaring sidecar containers to start alongside the container.")
+	runCmd.Flags().BoolVarP(&packageCache, "package-cache", "", false, "Persist the package manager cache in volumes between containers.")
+	runCmd.Flags().BoolVarP(&galaxyCache, "galaxy-cache", "", false, "Mount a cache on the host for the requirements which is reused by later runs.")
+	runCmd.Flags().StringVarP(&galaxyCacheDir, "galaxy-cache-dir", "", util.GalaxyCacheRoot(), "Directory on the host containing the galaxy caches.")
 
 	runCmd.Flags().StringVarP(&initialise, "initialise", "a", "/bin/systemd", "The initialise command for the image")
 	runCmd.Flags().StringVarP(&volume, "volume", "l", "/sys/fs/cgroup:/sys/fs/cgroup:ro", "The volume argument for the image")
@@ -48,10 +48,13 @@ containers won't be removed after completion.`,
 			Quiet:            quiet,
 		}
 
-		dist, _ := util.GetDistribution(image, image, "/sbin/init", "/sys/fs/cgroup:/sys/fs/cgroup:ro", user, distro)
-		report := util.NewReport(&config)
+		if _, err := util.SelectStagesOf(util.RoleStageNames, stageNames, fromStage); err != nil {
+			log.Fatalln(err)
+		}
 
+		dist, _ := util.GetDistribution(image, image, "/sbin/init", "/sys/fs/cgroup:/sys/fs/cgroup:ro", user, distro)
 		dist.CID = containerID
+		report := loadState(&config, &dist)
 
 		if dist.DockerCheck() {
 
@@ -65,34 +68,19 @@ containers won't be removed after completion.`,
 				}
 			}
 
-			util.MapPlaybook(&config)
-			util.MapInventory(dist.CID, &config)
-			util.MapRequirements(&config)
-
-			if !remote {
-				report.Ansible.Syntax = dist.RoleSyntaxCheck(&config)
-				if report.Ansible.Syntax {
-					report.Ansible.Run.Result, report.Ansible.Run.Time = dist.RoleTest(&config)
-				}
-				if report.Ansible.Run.Result {
-					report.Ansible.Idempotence.Result, report.Ansible.Idempotence.Time = dist.IdempotenceTest(&config)
-				}
-			} else {
-				report.Ansible.Syntax = dist.RoleSyntaxCheckRemote(&config)
-				if report.Ansible.Syntax {
-					report.Ansible.Run.Result, report.Ansible.Run.Time = dist.RoleTestRemote(&config)
-				}
-				if report.Ansible.Run.Result {
-					report.Ansible.Idempotence.Result, report.Ansible.Idempotence.Time = dist.IdempotenceTestRemote(&config)
-				}
-				hosts, _ := dist.AnsibleHosts(&config, &report)
-				for _, host := range hosts {
-					if host == "localhost" {
-						log.Errorln("remote runs should be run directly, not through this tool")
-						os.Exit(1)
-					}
-				}
+			if err := util.MapPlaybook(&config); err != nil {
+				log.Fatalln(err)
+			}
+			if err := util.MapInventory(dist.CID, &config); err != nil {
+				log.Fatalln(err)
 			}
+			if err := util.MapRequirements(&config); err != nil {
+				log.Fatalln(err)
+			}
+
+			report.Ansible.Skipped = []string{}
+			dist.RoleStages(&config, &report, stageSelection(&dist, util.RoleStageNames))
+			saveState(&dist, &report)
 		} else {
 			if !quiet {
 				log.Warnf("Container %v is not currently running", dist.CID)
@@ -109,9 +97,13 @@ func init() {
 	testCmd.Flags().StringVarP(&destination, "destination", "d", "", "Location which the role was mounted to")
 	testCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose mode for Ansible commands.")
 	testCmd.Flags().StringVarP(&playbook, "playbook", "p", "playbook.yml", "The filename of the playbook")
+	testCmd.Flags().StringVarP(&stateDir, "state-dir", "", util.StateRoot(), "Directory containing the state shared with run, install and destroy.")
 	testCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Enable quiet mode")
 	testCmd.Flags().StringVarP(&source, "source", "s", pwd, "Location of the role to test")
 	testCmd.Flags().BoolVarP(&remote, "remote", "m", false, "Run the test remotely to the container")
+	testCmd.Flags().StringSliceVarP(&stageNames, "stages", "", []string{}, "Stages to run: syntax, converge and idempotence (default all).")
+	testCmd.Flags().StringVarP(&fromStage, "from-stage", "", "", "Stage to start from, skipping the stages before it.")
+	testCmd.Flags().BoolVarP(&resume, "resume", "", false, "Start after the last stage which completed on the container.")
 
 	testCmd.MarkFlagRequired("name")
 }
@@ -0,0 +1,149 @@
+// Copyright © 2018 Karl Hepworth Karl.Hepworth@gmail.com
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fubarhouse/ansible-role-tester/util"
+)
+
+// fullTopology runs the complete end-to-end test process against every
+// instance declared in the topology file. Instances share a network and
+// Ansible runs from the host using a generated inventory. All containers
+// and the network are removed on completion.
+func fullTopology(config *util.AnsibleConfig) util.AnsibleReport {
+
+	if config.NetworkMode == util.NetworkNone {
+		fatal(1, "Network mode none cannot be used with a topology.")
+	}
+
+	if fixtures != "" {
+		fatal(1, "Fixtures cannot be used with a topology.")
+	}
+
+	// Options of a single container which a topology does not support.
+	for _, option := range []struct {
+		flag string
+		set  bool
+	}{
+		{"--stages", len(stageNames) > 0},
+		{"--from-stage", fromStage != ""},
+		{"--resume", resume},
+		{"--dockerfile", dockerfile != ""},
+		{"--snapshot", snapshot},
+		{"--sidecars", sidecarsFile != ""},
+		{"--artifacts", artifacts != ""},
+		{"--galaxy-cache", galaxyCache},
+		{"--digest", digest != ""},
+	} {
+		if option.set {
+			fatal(1, "%v cannot be used with a topology.", option.flag)
+		}
+	}
+
+	t, err := util.LoadTopology(sourcePath(topology))
+	if err != nil {
+		fatal(1, "%v", err)
+	}
+
+	prefix := containerID
+	if prefix == "" {
+		prefix = fmt.Sprint(time.Now().Unix())
+	}
+
+	if err := t.Resolve(prefix); err != nil {
+		fatal(1, "Incompatible distribution was inputted: %v", err)
+	}
+
+	util.CredentialHelper = credentialHelper
+	for i := range t.Distributions {
+		if mirror != "" {
+			if err := t.Distributions[i].UseMirror(mirror); err != nil {
+				fatal(1, "%v", err)
+			}
+		}
+		if err := t.Distributions[i].DockerPull(pullPolicy, quiet); err != nil {
+			if util.IsRegistryAuthError(err) {
+				fatal(util.RegistryAuthCode, "%v", err)
+			}
+			fatal(1, "%v", err)
+		}
+	}
+
+	// The role is still mounted into each container, as it would be otherwise.
+	if config.RemotePath == "" {
+		config.RemotePath = "/etc/ansible/roles/role_under_test"
+	}
+
+	report := util.NewReport(config)
+	report.Meta.ReportFile = reportFilename
+	report.Docker.Pull = pullPolicy
+	report.Docker.Network = config.NetworkName()
+
+	report.StageBegin(util.StageStart)
+	inventory, running := t.Up(config, &report)
+	report.Docker.Run = running
+	report.StageEnd(running)
+
+	if running {
+		// Playbooks are run against the topology from the host.
+		report.Environment.DockerVersion, _ = util.DockerVersion()
+		report.Environment.AnsibleVersion, report.Environment.PythonVersion, _ = util.AnsibleVersion("")
+		report.Ansible.Hosts = t.Hosts()
+		report.StageBegin(util.StageRequirements)
+		report.Ansible.Requirements = t.RoleInstall(config)
+		installed := report.Ansible.Requirements || config.RequirementsFile == ""
+		report.StageEnd(installed)
+		if installed {
+			report.StageBegin(util.StagePrepare)
+			report.Ansible.Prepare = t.RolePrepare(config, inventory)
+			report.StageEnd(report.Ansible.Prepare)
+		}
+		if report.Ansible.Prepare {
+			report.StageBegin(util.StageSyntax)
+			report.Ansible.Syntax = t.SyntaxCheck(config, inventory)
+			report.StageEnd(report.Ansible.Syntax)
+		}
+		if report.Ansible.Syntax {
+			report.StageBegin(util.StageConverge)
+			report.Ansible.Run.Result, report.Ansible.Run.Time = t.RoleTest(config, inventory)
+			report.StageEnd(report.Ansible.Run.Result)
+		}
+		if report.Ansible.Run.Result {
+			report.StageBegin(util.StageIdempotence)
+			report.Ansible.Idempotence.Result, report.Ansible.Idempotence.Time, report.Ansible.Idempotence.Changed = t.IdempotenceTest(config, inventory)
+			report.StageEnd(report.Ansible.Idempotence.Result)
+		}
+	}
+
+	report.StageBegin(util.StageDestroy)
+	report.Docker.Kill = t.Down(quiet)
+	report.StageEnd(report.Docker.Kill)
+
+	if reportProvided {
+		report.Ansible.Config = *config
+		printReport(&report)
+	}
+
+	return report
+}
@@ -0,0 +1,67 @@
+// Copyright © 2018 Karl Hepworth Karl.Hepworth@gmail.com
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fubarhouse/ansible-role-tester/util"
+	"github.com/spf13/cobra"
+)
+
+// versionCmd represents the version command
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the versions of the tool and the software it uses",
+	Long: `Print the versions of the tool and the software it uses.
+
+The same information is included in the environment section of reports.
+Ansible and Python versions are read from the container when --name is
+provided, and from the host otherwise. Versions which cannot be detected,
+such as Docker's when the daemon is not running, are not printed.`,
+	// Docker is not required to print the version.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		environment := util.NewEnvironment()
+		docker := util.CheckDocker() == nil
+		if docker {
+			environment.DockerVersion, _ = util.DockerVersion()
+		}
+		if docker || containerID == "" {
+			environment.AnsibleVersion, environment.PythonVersion, _ = util.AnsibleVersion(containerID)
+		}
+		if docker && containerID != "" {
+			image, err := util.DockerExec([]string{"inspect", "--format", "{{.Config.Image}}", containerID}, false)
+			if err == nil {
+				environment.ImageDigest, _ = util.ImageDigest(strings.TrimSpace(image))
+			}
+		}
+
+		environment.Printf()
+		fmt.Printf("Report schema: \t\t\t%v\n", util.ReportSchemaVersion)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().StringVarP(&containerID, "name", "n", "", "Name of a running container to read the Ansible and Python versions from.")
+}
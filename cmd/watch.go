@@ -0,0 +1,283 @@
+// Copyright © 2018 Karl Hepworth Karl.Hepworth@gmail.com
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fubarhouse/ansible-role-tester/pkg/tester"
+	"github.com/fubarhouse/ansible-role-tester/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// watchIdempotence indicates idempotence should be tested
+	// after each converge in watch mode.
+	watchIdempotence = false
+
+	// watchKeep indicates the container should not be removed
+	// when watch mode is stopped.
+	watchKeep = false
+
+	// watchDebounce is the time without changes watch mode
+	// waits for before testing the role.
+	watchDebounce time.Duration
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Test the role each time it changes",
+	Long: `Starts a container once, installs the requirements and then
+tests the syntax and converges the role each time a file in the
+role changes, printing a summary of each iteration.
+
+The summary is printed to stderr when results are written as TAP.
+
+The container is removed when watch is interrupted, unless it
+was already running or --keep is specified.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		names := stageNames
+		if len(names) == 0 {
+			names = []string{util.StageSyntax, util.StageConverge}
+		}
+		if watchIdempotence {
+			names = append(names, util.StageIdempotence)
+		}
+		selected, err := util.SelectStagesOf(util.RoleStageNames, names, "")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		config := util.AnsibleConfig{
+			HostPath:         source,
+			Inventory:        inventory,
+			RemotePath:       destination,
+			ExtraRolesPath:   extraRoles,
+			LibraryPath:      libraryPath,
+			RequirementsFile: requirements,
+			PlaybookFile:     playbook,
+			Dockerfile:       dockerfile,
+			Verbose:          verbose,
+			Remote:           remote,
+			Quiet:            quiet,
+		}
+
+		options := tester.Options{
+			Config:           config,
+			Name:             containerID,
+			Image:            image,
+			User:             user,
+			Distribution:     distro,
+			Custom:           custom,
+			Pull:             pullPolicy,
+			Mirror:           mirror,
+			CredentialHelper: credentialHelper,
+		}
+		if custom || cmd.Flags().Changed("initialise") {
+			options.Initialise = initialise
+		}
+		if custom || cmd.Flags().Changed("volume") {
+			options.Volume = volume
+		}
+		if tap != nil {
+			options.Listener = tap
+		}
+
+		dist, err := tester.New(options).Prepare(&config)
+		if err != nil {
+			log.Errorln(err)
+			if e, ok := err.(*tester.Error); ok {
+				os.Exit(e.Code)
+			}
+			os.Exit(1)
+		}
+
+		if config.RemotePath == "" {
+			if config.Remote {
+				pwd, _ := os.Getwd()
+				config.RemotePath = pwd
+			} else {
+				config.RemotePath = "/etc/ansible/roles/role_under_test"
+			}
+		}
+
+		if galaxyCache {
+			if err := util.PrepareGalaxyCache(&config, galaxyCacheDir); err != nil {
+				log.Fatalln(err)
+			}
+		}
+
+		if err := util.MapInventory(dist.CID, &config); err != nil {
+			log.Fatalln(err)
+		}
+		if err := util.MapRequirements(&config); err != nil {
+			log.Fatalln(err)
+		}
+		if err := util.MapPlaybook(&config); err != nil {
+			log.Fatalln(err)
+		}
+
+		report := util.NewReport(&config)
+		report.Ansible.Distribution = dist
+
+		started := false
+		if !dist.DockerCheck() {
+			if !dist.DockerRun(&config, &report) {
+				dist.DockerKill(quiet)
+				os.Exit(util.DockerRunCode)
+			}
+			started = true
+		}
+
+		if remote {
+			hosts, _ := dist.AnsibleHosts(&config, &report)
+			for _, host := range hosts {
+				if host == "localhost" {
+					log.Errorln("remote runs should be run directly, not through this tool")
+					if started {
+						dist.DockerKill(quiet)
+					}
+					os.Exit(1)
+				}
+			}
+		}
+
+		dist.RunStage(util.StageRequirements, map[string]bool{util.StageRequirements: true}, &report, func() bool {
+			report.Ansible.Requirements = dist.RoleInstall(&config)
+			return report.Ansible.Requirements
+		})
+		if !report.Ansible.Requirements {
+			log.Warnln("Requirements could not be installed, the role may fail to converge")
+		}
+
+		// The summary must not be mixed with the test points written to stdout.
+		summary := os.Stdout
+		if tap != nil {
+			summary = os.Stderr
+		}
+
+		watcher, err := util.NewWatcher(config.HostPath)
+		if err != nil {
+			log.Fatalf("Could not watch %v: %v", config.HostPath, err)
+		}
+		watcher.Debounce = watchDebounce
+
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		for iteration := 1; ; iteration++ {
+			fmt.Fprintln(summary, watchIteration(&dist, &config, &report, selected, iteration))
+			if dryRun {
+				break
+			}
+
+			if !quiet {
+				log.Infof("Watching %v for changes, press Ctrl+C to stop", config.HostPath)
+			}
+			changed, err := watcher.Wait(stop)
+			if err != nil {
+				log.Errorf("Could not watch %v: %v", config.HostPath, err)
+				break
+			}
+			if len(changed) == 0 {
+				break
+			}
+			if !quiet {
+				log.Infof("Changed: %v", strings.Join(changed, ", "))
+			}
+		}
+
+		if started && !watchKeep {
+			dist.DockerKill(quiet)
+		}
+	},
+}
+
+// watchIteration will run the selected stages of the role, stopping at
+// the first which fails, and return a summary of the stages which ran.
+func watchIteration(dist *util.Distribution, config *util.AnsibleConfig, report *util.AnsibleReport, selected map[string]bool, iteration int) string {
+
+	start := time.Now()
+	ran := len(report.Stages)
+	report.Ansible.Skipped = []string{}
+	dist.RoleStages(config, report, selected)
+
+	summary := []string{fmt.Sprintf("#%v %v", iteration, start.Format("15:04:05"))}
+	for _, stage := range report.Stages[ran:] {
+		if stage.Skipped {
+			continue
+		}
+		status := "failed"
+		if stage.Result {
+			status = "passed"
+		}
+		summary = append(summary, fmt.Sprintf("%v %v", stage.Name, status))
+	}
+	summary = append(summary, time.Since(start).Round(time.Second).String())
+
+	return strings.Join(summary, " | ")
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	pwd, _ := os.Getwd()
+	watchCmd.Flags().StringVarP(&containerID, "name", "n", containerID, "Container ID")
+	watchCmd.Flags().StringVarP(&source, "source", "s", pwd, "Location of the role to test")
+	watchCmd.Flags().StringVarP(&destination, "destination", "d", "", "Location which the role will be mounted to")
+	watchCmd.Flags().StringVarP(&requirements, "requirements", "r", "", "Path to requirements file.")
+	watchCmd.Flags().StringVarP(&extraRoles, "extra-roles", "x", "", "Path to roles folder with dependencies.")
+	watchCmd.Flags().StringVarP(&libraryPath, "library", "", "", "Path to library folder with modules.")
+	watchCmd.Flags().StringVarP(&playbook, "playbook", "p", "playbook.yml", "The filename of the playbook")
+	watchCmd.Flags().StringVarP(&inventory, "inventory", "e", "", "Inventory file")
+	watchCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Enable quiet mode")
+	watchCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose mode for Ansible commands.")
+	watchCmd.Flags().BoolVarP(&remote, "remote", "m", false, "Run the test remotely to the container")
+	watchCmd.Flags().BoolVarP(&custom, "custom", "c", false, "Provide my own custom distribution.")
+	watchCmd.Flags().StringVarP(&pullPolicy, "pull", "", util.PullMissing, "Image pull policy: always, missing or never.")
+	watchCmd.Flags().StringVarP(&mirror, "mirror", "", os.Getenv(util.MirrorEnv), "Registry to pull images from in place of their origin.")
+	watchCmd.Flags().StringVarP(&credentialHelper, "credential-helper", "", "", "Docker credential helper used to authenticate to the image registry (ie ecr-login).")
+	watchCmd.Flags().StringVarP(&dockerfile, "dockerfile", "", "", "Path to a Dockerfile to build the test image from (default tests/Dockerfile if present).")
+	watchCmd.Flags().StringSliceVarP(&stageNames, "stages", "", []string{}, "Stages to run each iteration: syntax, converge and idempotence (default syntax and converge).")
+	watchCmd.Flags().BoolVarP(&watchIdempotence, "idempotence", "", false, "Test idempotence after each converge.")
+	watchCmd.Flags().BoolVarP(&galaxyCache, "galaxy-cache", "", false, "Install requirements into a cache on the host which is reused by later runs.")
+	watchCmd.Flags().StringVarP(&galaxyCacheDir, "galaxy-cache-dir", "", util.GalaxyCacheRoot(), "Directory on the host containing the galaxy caches.")
+	watchCmd.Flags().BoolVarP(&watchKeep, "keep", "", false, "Keep the container when watch is stopped.")
+	watchCmd.Flags().DurationVarP(&watchDebounce, "debounce", "", util.WatchDebounce, "Time to wait for changes to settle before testing.")
+
+	watchCmd.Flags().StringVarP(&initialise, "initialise", "a", "/bin/systemd", "The initialise command for the image")
+	watchCmd.Flags().StringVarP(&volume, "volume", "l", "/sys/fs/cgroup:/sys/fs/cgroup:ro", "The volume argument for the image")
+
+	watchCmd.Flags().StringVarP(&image, "image", "i", "", "The image reference to use.")
+	watchCmd.Flags().StringVarP(&user, "user", "u", "fubarhouse", "Selectively choose a compatible docker image from a specified user.")
+	watchCmd.Flags().StringVarP(&distro, "distribution", "t", "ubuntu1804", "Selectively choose a compatible docker image of a specified distribution.")
+}
@@ -0,0 +1,425 @@
+package tester
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fubarhouse/ansible-role-tester/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Runner runs the complete test of a role in a container.
+//
+// Runners are serialised: util runs commands with one Executor,
+// credential helper and listener at a time, which a Runner installs for
+// the whole of Run or Prepare, so Runners in the same program wait for
+// each other rather than running concurrently.
+type Runner struct {
+	Options Options
+}
+
+// runners is held by the Runner which is using util.
+var runners sync.Mutex
+
+// New will return a Runner for the options.
+func New(options Options) *Runner {
+	return &Runner{
+		Options: options,
+	}
+}
+
+// rolePath will return the path to a file which may be relative
+// to the role, falling back to the path as it was provided.
+func (r *Runner) rolePath(path string) string {
+	if path != "" && !filepath.IsAbs(path) {
+		joined := filepath.Join(r.Options.Config.HostPath, path)
+		if _, err := os.Stat(joined); err == nil {
+			return joined
+		}
+	}
+	return path
+}
+
+// Distribution will return the distribution selected by the options.
+func (r *Runner) Distribution() (util.Distribution, error) {
+
+	o := r.Options
+
+	if !o.Custom {
+		dist, err := util.GetDistribution(o.Image, o.Image, "/sbin/init", "/sys/fs/cgroup:/sys/fs/cgroup:ro", o.User, o.Distribution)
+		if err != nil {
+			return dist, err
+		}
+		if o.Initialise != "" {
+			dist.Family.Initialise = o.Initialise
+		}
+		if o.Volume != "" {
+			dist.Family.Volume = o.Volume
+		}
+		return dist, nil
+	}
+
+	dist := *util.NewCustomDistribution()
+	ref, err := util.ParseImageReference(o.Image)
+	if err != nil {
+		return dist, fmt.Errorf("invalid custom image: %v", err)
+	}
+
+	dist.Privileged = true
+	util.CustomDistributionValueSet(&dist, "Name", o.Name)
+	util.CustomDistributionValueSet(&dist, "Container", ref.String())
+	util.CustomDistributionValueSet(&dist, "User", ref.Namespace)
+	util.CustomDistributionValueSet(&dist, "Distro", o.Image)
+	util.CustomFamilyValueSet(&dist.Family, "Initialise", o.Initialise)
+	util.CustomFamilyValueSet(&dist.Family, "Volume", o.Volume)
+
+	return dist, nil
+}
+
+// image will build or pull the image of the distribution.
+func (r *Runner) image(dist *util.Distribution, config *util.AnsibleConfig) error {
+
+	o := r.Options
+
+	if config.DockerfilePath() != "" {
+		if err := dist.DockerBuild(config, r.pullPolicy(), o.Mirror); err != nil {
+			if util.IsRegistryAuthError(err) {
+				return &Error{Code: util.RegistryAuthCode, Err: err}
+			}
+			return newError(util.DockerRunCode, "%v", err)
+		}
+		return nil
+	}
+
+	if o.Mirror != "" {
+		if err := dist.UseMirror(o.Mirror); err != nil {
+			return newError(util.DockerRunCode, "%v", err)
+		}
+	}
+	if o.Digest != "" {
+		if err := dist.PinDigest(o.Digest); err != nil {
+			return newError(util.DockerRunCode, "could not pin image to digest: %v", err)
+		}
+	}
+
+	if err := dist.DockerPull(r.pullPolicy(), config.Quiet); err != nil {
+		if util.IsRegistryAuthError(err) {
+			return &Error{Code: util.RegistryAuthCode, Err: err}
+		}
+		return &Error{Code: util.DockerRunCode, Err: err}
+	}
+
+	return nil
+}
+
+// pullPolicy will return the image pull policy, which is missing by default.
+func (r *Runner) pullPolicy() string {
+	if r.Options.Pull == "" {
+		return util.PullMissing
+	}
+	return r.Options.Pull
+}
+
+// Prepare will resolve the distribution selected by the options, name
+// its container and build or pull its image, checking the configuration
+// is for an Ansible role. This is the setup shared by everything which
+// starts a container for the role, and an Error is returned if it fails.
+func (r *Runner) Prepare(config *util.AnsibleConfig) (util.Distribution, error) {
+	defer r.use(r.executor(nil))()
+	return r.prepare(config)
+}
+
+// prepare is Prepare, using the executor which is already in use.
+func (r *Runner) prepare(config *util.AnsibleConfig) (util.Distribution, error) {
+
+	dist, err := r.Distribution()
+	if err != nil {
+		return dist, newError(util.DockerRunCode, "incompatible distribution was inputted: %v", err)
+	}
+
+	dist.CID = r.Options.Name
+	if dist.CID == "" {
+		dist.CID = fmt.Sprint(time.Now().Unix())
+	}
+
+	if err := r.image(&dist, config); err != nil {
+		return dist, err
+	}
+
+	if !config.IsAnsibleRole() {
+		return dist, newError(util.NotARoleCode, "path %v is not recognized as an Ansible role", config.HostPath)
+	}
+
+	return dist, nil
+}
+
+// executor will return the Executor the commands of the test are run
+// with, which is Options.Executor or otherwise util.CommandExecutor.
+// Commands run on the host are stopped when ctx is done.
+func (r *Runner) executor(ctx context.Context) util.Executor {
+	executor := r.Options.Executor
+	if executor == nil {
+		executor = util.CommandExecutor
+	}
+	if _, ok := executor.(*util.ExecExecutor); ok && ctx != nil {
+		return &util.ExecExecutor{Context: ctx}
+	}
+	return executor
+}
+
+// use will run commands with the executor, and with the credential
+// helper and listener of the options, until the returned func is called.
+func (r *Runner) use(executor util.Executor) func() {
+	runners.Lock()
+	commandExecutor, credentialHelper, listener := util.CommandExecutor, util.CredentialHelper, util.Listener
+	util.CommandExecutor = executor
+	util.CredentialHelper = r.Options.CredentialHelper
+	util.Listener = r.Options.Listener
+	return func() {
+		util.CommandExecutor, util.CredentialHelper, util.Listener = commandExecutor, credentialHelper, listener
+		runners.Unlock()
+	}
+}
+
+// stages will return the stages to run against the container,
+// starting after the last completed stage when resuming.
+func (r *Runner) stages(dist *util.Distribution) (map[string]bool, error) {
+
+	o := r.Options
+	if !o.Resume {
+		return util.SelectStages(o.Stages, o.FromStage)
+	}
+
+	completed := dist.StageCompleted()
+	selected, err := util.ResumeStages(util.Stages, o.Stages, completed)
+	if err == nil && !o.Config.Quiet {
+		if len(selected) == 0 {
+			log.Infof("All stages have completed on %v", dist.CID)
+		} else if completed != "" {
+			log.Infof("Resuming %v after the %v stage", dist.CID, completed)
+		}
+	}
+	return selected, err
+}
+
+// Run will test the role, returning the result once the container has
+// been removed. Cancelling the context stops the command which is running
+// and the stages after it, and the container is still removed. An Error
+// is returned if the test could not be started.
+func (r *Runner) Run(ctx context.Context) (*Result, error) {
+
+	o := r.Options
+	config := o.Config
+	quiet := config.Quiet
+
+	if _, err := util.SelectStages(o.Stages, o.FromStage); err != nil {
+		return nil, newError(1, "%v", err)
+	}
+
+	executor := r.executor(ctx)
+	defer r.use(executor)()
+
+	dist, err := r.prepare(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.GalaxyCache {
+		root := o.GalaxyCacheDir
+		if root == "" {
+			root = util.GalaxyCacheRoot()
+		}
+		if err := util.PrepareGalaxyCache(&config, root); err != nil {
+			return nil, newError(1, "%v", err)
+		}
+	}
+
+	snapshotUsed := false
+	if o.Snapshot {
+		if err := dist.SnapshotPrepare(&config); err != nil {
+			return nil, newError(1, "%v", err)
+		}
+		snapshotUsed = dist.SnapshotRestore(&config)
+	}
+
+	if err := util.MapInventory(dist.CID, &config); err != nil {
+		return nil, newError(1, "%v", err)
+	}
+	if err := util.MapRequirements(&config); err != nil {
+		return nil, newError(1, "%v", err)
+	}
+	if err := util.MapPlaybook(&config); err != nil {
+		return nil, newError(1, "%v", err)
+	}
+
+	report := util.NewReport(&config)
+	report.Ansible.Distribution = dist
+	report.Docker.Pull = r.pullPolicy()
+	report.Docker.Network = config.NetworkName()
+
+	if o.Artifacts != "" && !o.DryRun {
+		dir := util.ArtifactsDir(o.Artifacts, dist.CID, report.Meta.Timestamp)
+		recorder, err := util.NewStageRecorder(executor, dir)
+		if err != nil {
+			return nil, newError(1, "%v", err)
+		}
+		util.CommandExecutor = recorder
+		report.Meta.Artifacts = dir
+	}
+
+	// The container is removed even when the test was cancelled.
+	uncancel := func() {
+		if e, ok := executor.(*util.ExecExecutor); ok {
+			e.Context = nil
+		}
+	}
+
+	// The network, sidecars and container are removed if the test
+	// cannot be started once they are being created.
+	cleanup := false
+	defer func() {
+		if cleanup && !o.Keep {
+			uncancel()
+			dist.DockerKill(quiet)
+		}
+	}()
+
+	result := &Result{}
+	finish := func() *Result {
+		cleanup = false
+		uncancel()
+		if !o.Keep {
+			report.StageBegin(util.StageDestroy)
+			dist.DockerKill(quiet)
+			if !dist.DockerCheck() {
+				report.Docker.Kill = true
+			}
+			report.StageEnd(report.Docker.Kill)
+		}
+		report.Ansible.Config = config
+		result.Report = report
+		result.ExitCode = ExitCode(&report)
+		return result
+	}
+
+	if o.Fixtures != "" {
+		server := &util.FixtureServer{
+			Dir:   r.rolePath(o.Fixtures),
+			Hosts: append([]string{util.FixturesHost}, o.FixtureHosts...),
+			Port:  o.FixturesPort,
+		}
+		if !o.DryRun {
+			var err error
+			server, err = util.NewFixtureServer(r.rolePath(o.Fixtures), o.FixturesPort, o.FixtureHosts, quiet)
+			if err != nil {
+				return nil, newError(1, "%v", err)
+			}
+			defer server.Close()
+		}
+		if config.NetworkMode != "" {
+			log.Warnf("Fixtures are not reachable with network mode %v", config.NetworkMode)
+		}
+		config.ExtraHosts = append(config.ExtraHosts, server.ExtraHosts()...)
+		config.Env = append(config.Env, server.Env()...)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if !dist.DockerCheck() {
+		cleanup = true
+		if err := dist.NetworkPrepare(&config); err != nil {
+			return nil, &Error{Code: util.DockerRunCode, Err: err}
+		}
+		if o.Sidecars != "" {
+			sidecars, err := util.LoadSidecars(r.rolePath(o.Sidecars))
+			if err != nil {
+				return nil, newError(1, "%v", err)
+			}
+			if o.Mirror != "" {
+				if err := util.UseMirrorSidecars(sidecars, o.Mirror); err != nil {
+					return nil, newError(util.DockerRunCode, "%v", err)
+				}
+			}
+			if err := dist.SidecarsRun(&config, &report, sidecars, r.pullPolicy()); err != nil {
+				if util.IsRegistryAuthError(err) {
+					return nil, &Error{Code: util.RegistryAuthCode, Err: err}
+				}
+				return nil, &Error{Code: util.DockerRunCode, Err: err}
+			}
+		}
+		report.StageBegin(util.StageStart)
+		dist.DockerRun(&config, &report)
+		report.Docker.Run = dist.DockerCheck()
+		report.StageEnd(report.Docker.Run)
+	} else {
+		report.Docker.Run = true
+	}
+
+	if !report.Docker.Run {
+		return finish(), nil
+	}
+
+	report.Docker.Digest, _ = util.ImageDigest(dist.Container)
+	dist.DetectEnvironment(&config, &report)
+	hosts, _ := dist.AnsibleHosts(&config, &report)
+	report.Ansible.Hosts = hosts
+	if config.Remote {
+		for _, host := range hosts {
+			if host == "localhost" {
+				finish()
+				return nil, newError(1, "remote runs should be run directly, not through this tool")
+			}
+		}
+	}
+
+	selected, err := r.stages(&dist)
+	if err != nil {
+		finish()
+		return nil, newError(1, "%v", err)
+	}
+
+	prepared := true
+	if snapshotUsed {
+		report.Ansible.Requirements = config.RequirementsFile != ""
+		report.Ansible.Prepare = true
+		report.Docker.Snapshot = config.Snapshot
+		dist.StageRecord(util.StagePrepare)
+	} else {
+		installed := dist.RunStage(util.StageRequirements, selected, &report, func() bool {
+			report.Ansible.Requirements = dist.RoleInstall(&config)
+			return report.Ansible.Requirements || config.RequirementsFile == ""
+		})
+		if err := ctx.Err(); err != nil {
+			return finish(), err
+		}
+		prepared = dist.RunStage(util.StagePrepare, selected, &report, func() bool {
+			report.Ansible.Prepare = dist.RolePrepare(&config)
+			return report.Ansible.Prepare
+		})
+		// Only containers which ran both stages are snapshotted.
+		if installed && prepared && selected[util.StageRequirements] && selected[util.StagePrepare] {
+			if dist.SnapshotCommit(&config) {
+				report.Docker.Snapshot = config.Snapshot
+			}
+		}
+	}
+
+	if prepared {
+		for _, stage := range util.RoleStageNames {
+			if err := ctx.Err(); err != nil {
+				return finish(), err
+			}
+			if !dist.RoleStage(stage, &config, &report, selected) {
+				break
+			}
+		}
+	}
+
+	return finish(), nil
+}
@@ -0,0 +1,168 @@
+// Package tester runs the complete test of an Ansible role in a container,
+// as performed by the full command, for use by other Go programs.
+//
+//	runner := tester.New(tester.Options{
+//		Config: util.AnsibleConfig{
+//			HostPath:     "/path/to/role",
+//			PlaybookFile: "playbook.yml",
+//		},
+//		User:         "fubarhouse",
+//		Distribution: "ubuntu1804",
+//	})
+//	result, err := runner.Run(ctx)
+//
+// Runners in the same program run one at a time, see Runner.
+package tester
+
+import (
+	"fmt"
+
+	"github.com/fubarhouse/ansible-role-tester/util"
+)
+
+// Options configure a Runner. They correspond to the flags of the full
+// command, and the zero value of each uses the same default as the flag.
+type Options struct {
+	// Config is the configuration of the role under test.
+	Config util.AnsibleConfig
+
+	// Name is the name of the container, which is
+	// generated from the current time when empty.
+	Name string
+
+	// Image is the image reference used to select a distribution,
+	// or the image to run when Custom is true.
+	Image string
+
+	// User and Distribution select a distribution when Image is empty.
+	User         string
+	Distribution string
+
+	// Custom indicates Image is a custom image, which is
+	// started with Initialise and Volume.
+	Custom bool
+
+	// Initialise and Volume override the initialise command and
+	// volume of the distribution when they are not empty.
+	Initialise string
+	Volume     string
+
+	// Pull is the image pull policy, which is missing when empty.
+	Pull string
+
+	// Digest pins the image to a digest.
+	Digest string
+
+	// Mirror is a registry to pull images from in place of their origin.
+	Mirror string
+
+	// CredentialHelper is a docker credential helper used to
+	// authenticate to the registry of the image.
+	CredentialHelper string
+
+	// GalaxyCache indicates requirements should be installed into a
+	// cache on the host in GalaxyCacheDir, or util.GalaxyCacheRoot.
+	GalaxyCache    bool
+	GalaxyCacheDir string
+
+	// Snapshot indicates the container should be snapshotted after
+	// requirements and prepare, and the snapshot reused by later runs.
+	Snapshot bool
+
+	// Sidecars is the path to a file declaring sidecar containers.
+	Sidecars string
+
+	// Fixtures is the path to a directory of fixtures served to the
+	// container on FixturesPort, or an ephemeral port when it is zero,
+	// and resolved by FixtureHosts.
+	Fixtures     string
+	FixturesPort int
+	FixtureHosts []string
+
+	// Stages and FromStage select the stages to run, and Resume
+	// starts after the last stage completed on the container.
+	Stages    []string
+	FromStage string
+	Resume    bool
+
+	// Keep indicates the container should not be removed after the test.
+	Keep bool
+
+	// Artifacts is the directory which the output of each stage is
+	// written to, in a directory for the run. Output is not kept when
+	// it is empty.
+	Artifacts string
+
+	// DryRun indicates the Executor only plans the commands,
+	// so the fixture server is not started.
+	DryRun bool
+
+	// Executor runs the commands of the test. Commands are run
+	// with util.CommandExecutor when it is nil.
+	Executor util.Executor
+
+	// Listener is notified of each stage as it completes, when it is set.
+	Listener util.StageListener
+}
+
+// Result is the outcome of a test.
+type Result struct {
+	// Report contains the results of each stage.
+	Report util.AnsibleReport
+
+	// ExitCode is the exit code the full command would exit with.
+	ExitCode int
+}
+
+// Passed will return true if every stage passed.
+func (result *Result) Passed() bool {
+	return result.ExitCode == util.OKCode
+}
+
+// Error is returned when a test could not be started, such as when
+// the distribution is not known or the image could not be pulled.
+type Error struct {
+	// Code is the exit code the full command would exit with.
+	Code int
+
+	// Err is the cause of the error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap will return the cause of the error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError will return an Error with the code for the formatted message.
+func newError(code int, format string, args ...interface{}) *Error {
+	return &Error{
+		Code: code,
+		Err:  fmt.Errorf(format, args...),
+	}
+}
+
+// ExitCode will return the exit code for the report, which
+// identifies the first stage of the test which failed. Stages
+// which were skipped are not failures.
+func ExitCode(report *util.AnsibleReport) int {
+	passed := func(stage string, result bool) bool {
+		return result || report.StageSkipped(stage)
+	}
+	if !report.Docker.Run {
+		return util.DockerRunCode
+	} else if !passed(util.StagePrepare, report.Ansible.Prepare) {
+		return util.AnsiblePrepareCode
+	} else if !passed(util.StageSyntax, report.Ansible.Syntax) {
+		return util.AnsibleSyntaxCode
+	} else if !passed(util.StageConverge, report.Ansible.Run.Result) {
+		return util.AnsibleRunCode
+	} else if !passed(util.StageIdempotence, report.Ansible.Idempotence.Result) {
+		return util.AnsibleIdempotenceCode
+	}
+	return util.OKCode
+}
@@ -0,0 +1,270 @@
+package tester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fubarhouse/ansible-role-tester/util"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestExitCode(t *testing.T) {
+
+	passed := func() util.AnsibleReport {
+		report := util.AnsibleReport{}
+		report.Docker.Run = true
+		report.Ansible.Prepare = true
+		report.Ansible.Syntax = true
+		report.Ansible.Run.Result = true
+		report.Ansible.Idempotence.Result = true
+		return report
+	}
+
+	tests := []struct {
+		name   string
+		modify func(report *util.AnsibleReport)
+		want   int
+	}{
+		{"passed", func(report *util.AnsibleReport) {}, util.OKCode},
+		{"docker run", func(report *util.AnsibleReport) {
+			report.Docker.Run = false
+			report.Ansible.Syntax = false
+		}, util.DockerRunCode},
+		{"prepare", func(report *util.AnsibleReport) { report.Ansible.Prepare = false }, util.AnsiblePrepareCode},
+		{"syntax", func(report *util.AnsibleReport) {
+			report.Ansible.Syntax = false
+			report.Ansible.Run.Result = false
+		}, util.AnsibleSyntaxCode},
+		{"run", func(report *util.AnsibleReport) { report.Ansible.Run.Result = false }, util.AnsibleRunCode},
+		{"idempotence", func(report *util.AnsibleReport) { report.Ansible.Idempotence.Result = false }, util.AnsibleIdempotenceCode},
+		{"skipped", func(report *util.AnsibleReport) {
+			report.Ansible.Prepare = false
+			report.Ansible.Idempotence.Result = false
+			report.Skip(util.StagePrepare)
+			report.Skip(util.StageIdempotence)
+		}, util.OKCode},
+		{"skipped before failure", func(report *util.AnsibleReport) {
+			report.Ansible.Syntax = false
+			report.Ansible.Run.Result = false
+			report.Skip(util.StageSyntax)
+		}, util.AnsibleRunCode},
+	}
+
+	for _, test := range tests {
+		report := passed()
+		test.modify(&report)
+		if got := ExitCode(&report); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+		if result := (&Result{ExitCode: ExitCode(&report)}); result.Passed() != (test.want == util.OKCode) {
+			t.Errorf("%v: Passed() returned %v", test.name, result.Passed())
+		}
+	}
+}
+
+func TestRunnerExecutor(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir, err := ioutil.TempDir("", "role")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range []string{"tasks/main.yml", "meta/main.yml"} {
+		path := filepath.Join(dir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("---\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	executor := &util.FakeExecutor{}
+	var helper string
+	executor.Respond = func(command util.Command) (util.CommandResult, error) {
+		helper = util.CredentialHelper
+		return util.CommandResult{}, nil
+	}
+
+	runner := New(Options{
+		User:             "fubarhouse",
+		Distribution:     "ubuntu1804",
+		Pull:             util.PullAlways,
+		CredentialHelper: "ecr-login",
+		Executor:         executor,
+	})
+	if _, err := runner.Prepare(&util.AnsibleConfig{HostPath: dir, Quiet: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(executor.Commands) == 0 {
+		t.Fatal("no commands were run with the executor of the options")
+	}
+	if helper != "ecr-login" {
+		t.Errorf("commands were run with the credential helper %q, want ecr-login", helper)
+	}
+	if util.CommandExecutor == executor || util.CredentialHelper != "" {
+		t.Error("the executor and credential helper were not restored")
+	}
+}
+
+// fakeDocker will return a FakeExecutor which tracks the containers and
+// networks it creates, failing the commands for which fail returns true.
+func fakeDocker(fail func(command util.Command) bool) (*util.FakeExecutor, map[string]bool) {
+
+	created := map[string]bool{}
+	filters := func(args []string) []string {
+		values := []string{}
+		for i, arg := range args {
+			if (arg == "--filter" || arg == "-f") && i+1 < len(args) {
+				values = append(values, args[i+1])
+			}
+		}
+		return values
+	}
+
+	fake := &util.FakeExecutor{}
+	fake.Respond = func(command util.Command) (util.CommandResult, error) {
+		if fail != nil && fail(command) {
+			return util.CommandResult{ExitCode: 2}, errors.New("exit status 2")
+		}
+		result := util.CommandResult{}
+		args := command.Args
+		if command.Name != "docker" || len(args) < 2 {
+			return result, nil
+		}
+		switch args[0] {
+		case "run":
+			for _, arg := range args {
+				if strings.HasPrefix(arg, "--name=") {
+					created[strings.TrimPrefix(arg, "--name=")] = true
+				}
+			}
+		case "stop", "rm":
+			for _, arg := range args[1:] {
+				delete(created, arg)
+			}
+		case "network":
+			switch args[1] {
+			case "create":
+				created[args[len(args)-1]] = true
+			case "rm":
+				for _, arg := range args[2:] {
+					delete(created, arg)
+				}
+			case "ls":
+				for name := range created {
+					for _, filter := range filters(args) {
+						if strings.HasPrefix(filter, "label=") || filter == "name=^"+name+"$" {
+							result.Stdout += name + "\n"
+						}
+					}
+				}
+			}
+		case "ps":
+			if len(filters(args)) == 1 {
+				for name := range created {
+					result.Stdout += fmt.Sprintf("'%v'\n", name)
+				}
+			}
+		case "exec":
+			result.Stdout = "art-test : ok=1 changed=0 unreachable=0 failed=0\n"
+		}
+		return result, nil
+	}
+
+	return fake, created
+}
+
+func TestRun(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir, err := ioutil.TempDir("", "role")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range []string{"tasks/main.yml", "meta/main.yml", "tests/playbook.yml", "tests/sidecars.yml"} {
+		path := filepath.Join(dir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("---\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	options := func(executor util.Executor) Options {
+		return Options{
+			Config: util.AnsibleConfig{
+				HostPath:     dir,
+				PlaybookFile: "tests/playbook.yml",
+				NetworkMode:  util.NetworkInternal,
+				Quiet:        true,
+			},
+			Name:         "art-test",
+			User:         "fubarhouse",
+			Distribution: "ubuntu1804",
+			Executor:     executor,
+		}
+	}
+
+	t.Run("passed", func(t *testing.T) {
+		executor, created := fakeDocker(nil)
+		result, err := New(options(executor)).Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Passed() {
+			t.Errorf("the test exited with %v, want %v", result.ExitCode, util.OKCode)
+		}
+		if len(created) != 0 {
+			t.Errorf("%v were not removed", created)
+		}
+	})
+
+	t.Run("converge failed", func(t *testing.T) {
+		executor, created := fakeDocker(func(command util.Command) bool {
+			args := strings.Join(command.Args, " ")
+			return strings.Contains(args, "ansible-playbook") && !strings.Contains(args, "--syntax-check")
+		})
+		result, err := New(options(executor)).Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.ExitCode != util.AnsibleRunCode {
+			t.Errorf("the test exited with %v, want %v", result.ExitCode, util.AnsibleRunCode)
+		}
+		if !result.Report.Docker.Kill || len(created) != 0 {
+			t.Errorf("%v were not removed", created)
+		}
+	})
+
+	t.Run("sidecars failed", func(t *testing.T) {
+		executor, created := fakeDocker(nil)
+		o := options(executor)
+		o.Sidecars = "tests/missing.yml"
+		if _, err := New(o).Run(context.Background()); err == nil {
+			t.Fatal("the test started without its sidecars")
+		}
+		if len(created) != 0 {
+			t.Errorf("%v were not removed", created)
+		}
+
+		executor, created = fakeDocker(nil)
+		o = options(executor)
+		o.Sidecars = "tests/missing.yml"
+		o.Keep = true
+		New(o).Run(context.Background())
+		if !created["art-test-network"] {
+			t.Error("the network was removed when it was kept")
+		}
+	})
+}
@@ -1,12 +1,7 @@
 package util
 
 import (
-	"bytes"
 	"fmt"
-	"io"
-	"os"
-	"os/exec"
-	"sync"
 	"time"
 
 	"strings"
@@ -62,7 +57,7 @@ func (dist *Distribution) AnsibleHosts(config *AnsibleConfig, report *AnsibleRep
 
 // IdempotenceTestRemote will run an Ansible playbook once and check the
 // output for any changed or failed tasks as reported by Ansible.
-func (dist *Distribution) IdempotenceTestRemote(config *AnsibleConfig) (bool, time.Duration) {
+func (dist *Distribution) IdempotenceTestRemote(config *AnsibleConfig) (bool, time.Duration, []string) {
 
 	// Test role idempotence.
 	if !config.Quiet {
@@ -90,20 +85,23 @@ func (dist *Distribution) IdempotenceTestRemote(config *AnsibleConfig) (bool, ti
 	}
 
 	var idempotence = false
+	var changes []string
 	now := time.Now()
 	if !config.Quiet {
 		out, _ := AnsiblePlaybook(args, true)
 		idempotence = IdempotenceResult(out)
+		changes = IdempotenceChanges(out)
 	} else {
 		out, _ := AnsiblePlaybook(args, false)
 		idempotence = IdempotenceResult(out)
+		changes = IdempotenceChanges(out)
 	}
 
 	if !config.Quiet {
 		PrintIdempotenceResult(now, idempotence)
 	}
 
-	return idempotence, time.Since(now)
+	return idempotence, time.Since(now), changes
 
 }
 
@@ -160,54 +158,36 @@ func (dist *Distribution) RoleTestRemote(config *AnsibleConfig) (bool, time.Dura
 // binary and use the input args as arguments for that process.
 // You can request output be printed using the bool stdout.
 func AnsiblePlaybook(args []string, stdout bool) (string, error) {
+	return AnsiblePlaybookEnv(args, []string{}, stdout)
+}
 
-	// If we haven't found Ansible yet, we should look for it.
-	if ansibleplaybook == "" {
-		a, e := exec.LookPath("ansible-playbook")
-		if e != nil {
-			log.Errorln("executable 'ansible-playbook' was not found in $PATH.")
-		}
-		ansibleplaybook = a
-	}
-
-	// Generate the command, based on input.
-	cmd := exec.Cmd{}
-	cmd.Path = ansibleplaybook
-	cmd.Args = []string{ansibleplaybook}
-
-	// Add our arguments to the command.
-	cmd.Args = append(cmd.Args, args...)
-
-	// If configured, print to os.Stdout.
-	if stdout {
-		cmd.Stdout = os.Stdout
-		cmd.Stdin = os.Stdin
-		cmd.Stderr = os.Stderr
-	}
-
-	// Create a buffer for the output.
-	var out bytes.Buffer
-	multi := io.MultiWriter(&out)
+// AnsiblePlaybookEnv will execute a command to the ansible-playbook
+// binary in the same way as AnsiblePlaybook, with the additional
+// environment variables (in the form KEY=value) set for the process.
+func AnsiblePlaybookEnv(args []string, env []string, stdout bool) (string, error) {
+	return ansibleExec("ansible-playbook", args, env, stdout)
+}
 
-	//if stdout && !noOutput {
-	if stdout {
-		multi = io.MultiWriter(&out, os.Stdout)
-	}
+// AnsibleGalaxyEnv will execute a command to the ansible-galaxy binary
+// on the host, with the additional environment variables set for the process.
+func AnsibleGalaxyEnv(args []string, env []string, stdout bool) (string, error) {
+	return ansibleExec("ansible-galaxy", args, env, stdout)
+}
 
-	// Assign the output to the writer.
-	cmd.Stdout = multi
+// ansibleExec will execute the Ansible binary with the input args.
+func ansibleExec(name string, args []string, env []string, stdout bool) (string, error) {
 
-	// Check the errors, return as needed.
-	var wg sync.WaitGroup
-	wg.Add(1)
-	if err := cmd.Run(); err != nil {
+	result, err := execute(Command{
+		Name:   name,
+		Args:   args,
+		Env:    env,
+		Stream: stdout,
+	})
+	if err != nil {
 		log.Errorln(err)
-		return out.String(), err
 	}
-	wg.Done()
 
-	// Return out output as a string.
-	return out.String(), nil
+	return result.Stdout, err
 }
 
 // RoleSyntaxCheckRemote will run a syntax check of the specified container.
@@ -0,0 +1,245 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// StageStart starts the container.
+	StageStart = "start"
+
+	// StageDestroy removes the container.
+	StageDestroy = "destroy"
+)
+
+// StageResult is the outcome of a stage, recorded in the report.
+type StageResult struct {
+	// Name is the name of the stage, ie converge.
+	Name string `json:"name" yaml:"name"`
+	// Start and End are the times the stage started and ended.
+	Start time.Time `json:"start" yaml:"start"`
+	End   time.Time `json:"end" yaml:"end"`
+	// Duration is the time the stage took.
+	Duration time.Duration `json:"duration" yaml:"duration"`
+	// Result indicates the stage passed.
+	Result bool `json:"result" yaml:"result"`
+	// Skipped indicates the stage was not selected to run.
+	Skipped bool `json:"skipped" yaml:"skipped"`
+	// ExitCode is the exit code of the last command of the
+	// stage which failed, or zero if none of them failed.
+	ExitCode int `json:"exit_code" yaml:"exit_code"`
+	// Output is the path to the file containing the output of
+	// the commands run by the stage, when artifacts are kept.
+	Output string `json:"output" yaml:"output"`
+	// failedCommand and failedOutput are the last command of the
+	// stage which failed and its output, which are not kept in the
+	// report but describe the failure when artifacts are not kept.
+	failedCommand string
+	failedOutput  string
+}
+
+// ArtifactsDir will return the directory in root which the artifacts
+// of a run against the container are written to, which is unique to
+// the container and the time the run started.
+func ArtifactsDir(root, name string, timestamp time.Time) string {
+	return filepath.Join(root, fmt.Sprintf("%v-%v", name, timestamp.Format("20060102-150405")))
+}
+
+// StageRecorder is an Executor which runs commands with another Executor
+// and writes the output of the commands run by each stage to a file in
+// Dir. It is installed as CommandExecutor for one test at a time.
+type StageRecorder struct {
+	Executor Executor
+	Dir      string
+
+	file  *os.File
+	count int
+	mu    sync.Mutex
+}
+
+// NewStageRecorder will return a StageRecorder which runs commands
+// with the executor, creating the directory for the output.
+func NewStageRecorder(executor Executor, dir string) (*StageRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create artifacts directory: %v", err)
+	}
+	return &StageRecorder{
+		Executor: executor,
+		Dir:      dir,
+	}, nil
+}
+
+// Execute will run the command, writing it and its output
+// to the file of the current stage if one has begun.
+func (s *StageRecorder) Execute(command Command) (CommandResult, error) {
+
+	result, err := s.Executor.Execute(command)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return result, err
+	}
+	fmt.Fprintf(s.file, "$ %v\n%v%v", command, result.Stdout, result.Stderr)
+	if err != nil {
+		fmt.Fprintf(s.file, "# %v\n", err)
+	}
+
+	return result, err
+}
+
+// Begin will create the file which the output of
+// the stage is written to, returning its path.
+func (s *StageRecorder) Begin(stage string) string {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.count++
+	path := filepath.Join(s.Dir, fmt.Sprintf("%02d-%v.log", s.count, stage))
+	file, err := os.Create(path)
+	if err != nil {
+		log.Errorf("could not create the output of %v: %v", stage, err)
+		return ""
+	}
+	s.file = file
+	return path
+}
+
+// End will close the file of the current stage.
+func (s *StageRecorder) End() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// stageFailure is the last command which failed since
+// the stage in progress began, with its exit code and output.
+var stageFailure struct {
+	sync.Mutex
+	command  string
+	exitCode int
+	output   string
+}
+
+// stageFailed will record a command which failed and its result.
+func stageFailed(command Command, result CommandResult) {
+	stageFailure.Lock()
+	defer stageFailure.Unlock()
+	stageFailure.command = command.String()
+	stageFailure.exitCode = result.ExitCode
+	stageFailure.output = result.Stdout + result.Stderr
+}
+
+// stageRecorder will return the StageRecorder
+// in use by CommandExecutor, or nil.
+func stageRecorder() *StageRecorder {
+	recorder, _ := CommandExecutor.(*StageRecorder)
+	return recorder
+}
+
+// StageBegin will record the start of the stage in the report,
+// capturing its output when a StageRecorder is in use.
+func (report *AnsibleReport) StageBegin(stage string) {
+	stageFailure.Lock()
+	stageFailure.command, stageFailure.exitCode, stageFailure.output = "", 0, ""
+	stageFailure.Unlock()
+
+	result := StageResult{
+		Name:  stage,
+		Start: time.Now(),
+	}
+	if recorder := stageRecorder(); recorder != nil {
+		result.Output = recorder.Begin(stage)
+	}
+	report.Stages = append(report.Stages, result)
+}
+
+// StageEnd will record the end and result of the stage which began
+// last in the report, with the exit code of the last command which failed.
+func (report *AnsibleReport) StageEnd(passed bool) {
+	if len(report.Stages) == 0 {
+		return
+	}
+	result := &report.Stages[len(report.Stages)-1]
+	result.End = time.Now()
+	result.Duration = result.End.Sub(result.Start)
+	result.Result = passed
+	if recorder := stageRecorder(); recorder != nil {
+		recorder.End()
+	}
+	stageFailure.Lock()
+	result.ExitCode = stageFailure.exitCode
+	if !passed {
+		result.failedCommand, result.failedOutput = stageFailure.command, stageFailure.output
+	}
+	stageFailure.Unlock()
+	notifyStage(report, *result)
+}
+
+// ReportStages is every stage which may be recorded in a report, in the order they run.
+var ReportStages = []string{
+	StageStart,
+	StageRequirements,
+	StagePrepare,
+	StageSyntax,
+	StageConverge,
+	StageIdempotence,
+	StageDestroy,
+}
+
+// Stage will return the last result of the stage in the report,
+// and false if the stage did not run.
+func (report *AnsibleReport) Stage(name string) (StageResult, bool) {
+	for i := len(report.Stages) - 1; i >= 0; i-- {
+		if report.Stages[i].Name == name {
+			return report.Stages[i], true
+		}
+	}
+	return StageResult{Name: name}, false
+}
+
+// Status will return passed, failed or skipped for the stage.
+func (stage StageResult) Status() string {
+	if stage.Skipped {
+		return "skipped"
+	}
+	if stage.Result {
+		return "passed"
+	}
+	return "failed"
+}
+
+// FailureOutput will return the output of the stage when it was kept,
+// or otherwise the output of the last command of the stage which failed.
+func (stage StageResult) FailureOutput() string {
+	if output := stage.ReadOutput(); output != "" {
+		return output
+	}
+	return stage.failedOutput
+}
+
+// ReadOutput will return the output of the stage, or an
+// empty string if it was not kept or cannot be read.
+func (stage StageResult) ReadOutput() string {
+	if stage.Output == "" {
+		return ""
+	}
+	data, err := ioutil.ReadFile(stage.Output)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,138 @@
+package util
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStageRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := &FakeExecutor{
+		Respond: func(command Command) (CommandResult, error) {
+			if command.Args[0] == "fail" {
+				return CommandResult{Stderr: "failed\n", ExitCode: 2}, errors.New("exit status 2")
+			}
+			return CommandResult{Stdout: "ok\n"}, nil
+		},
+	}
+	recorder, err := NewStageRecorder(fake, filepath.Join(dir, "run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := CommandExecutor
+	CommandExecutor = recorder
+	defer func() { CommandExecutor = executor }()
+
+	report := AnsibleReport{}
+	execute(Command{Name: "docker", Args: []string{"before"}})
+
+	report.StageBegin(StageConverge)
+	execute(Command{Name: "docker", Args: []string{"fail"}})
+	execute(Command{Name: "docker", Args: []string{"pass"}})
+	report.StageEnd(false)
+
+	report.StageBegin(StageDestroy)
+	execute(Command{Name: "docker", Args: []string{"pass"}})
+	report.StageEnd(true)
+
+	report.Skip(StageIdempotence)
+
+	tests := []struct {
+		name     string
+		result   bool
+		skipped  bool
+		exitCode int
+		output   string
+	}{
+		{StageConverge, false, false, 2, "$ docker fail\nfailed\n# exit status 2\n$ docker pass\nok\n"},
+		{StageDestroy, true, false, 0, "$ docker pass\nok\n"},
+		{StageIdempotence, false, true, 0, ""},
+	}
+
+	if len(report.Stages) != len(tests) {
+		t.Fatalf("%v stages were recorded, want %v", len(report.Stages), len(tests))
+	}
+	for i, test := range tests {
+		stage := report.Stages[i]
+		if stage.Name != test.name || stage.Result != test.result || stage.Skipped != test.skipped || stage.ExitCode != test.exitCode {
+			t.Errorf("stage %v = %+v, want %+v", i, stage, test)
+		}
+		if stage.End.Before(stage.Start) || stage.Duration != stage.End.Sub(stage.Start) {
+			t.Errorf("stage %v has start %v, end %v and duration %v", test.name, stage.Start, stage.End, stage.Duration)
+		}
+		if test.output == "" {
+			if stage.Output != "" {
+				t.Errorf("stage %v has output %v", test.name, stage.Output)
+			}
+			continue
+		}
+		if !strings.HasPrefix(stage.Output, filepath.Join(dir, "run")) {
+			t.Errorf("stage %v output %v is not in the artifacts directory", test.name, stage.Output)
+		}
+		data, err := ioutil.ReadFile(stage.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.output {
+			t.Errorf("stage %v output = %q, want %q", test.name, data, test.output)
+		}
+	}
+}
+
+func TestStageExitCode(t *testing.T) {
+	fake := &FakeExecutor{
+		Respond: func(command Command) (CommandResult, error) {
+			if command.Args[0] == "fail" {
+				return CommandResult{ExitCode: 4}, errors.New("exit status 4")
+			}
+			return CommandResult{}, nil
+		},
+	}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	report := AnsibleReport{}
+	execute(Command{Name: "docker", Args: []string{"fail"}})
+
+	report.StageBegin(StageSyntax)
+	execute(Command{Name: "docker", Args: []string{"pass"}})
+	report.StageEnd(true)
+
+	report.StageBegin(StageConverge)
+	execute(Command{Name: "docker", Args: []string{"fail"}})
+	execute(Command{Name: "docker", Args: []string{"pass"}})
+	report.StageEnd(false)
+
+	if stage := report.Stages[0]; stage.ExitCode != 0 {
+		t.Errorf("stage %v has exit code %v, want 0", stage.Name, stage.ExitCode)
+	}
+	if stage := report.Stages[1]; stage.ExitCode != 4 || stage.Output != "" {
+		t.Errorf("stage %v has exit code %v and output %q, want 4 without output", stage.Name, stage.ExitCode, stage.Output)
+	}
+}
+
+// writeStageOutput will write the output of a converge stage to a new
+// temporary directory, returning its path and a func removing it.
+func writeStageOutput(t *testing.T, output string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "stage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "05-converge.log")
+	if err := ioutil.WriteFile(path, []byte(output), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
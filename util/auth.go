@@ -0,0 +1,275 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RegistryUsernameEnv is the environment variable containing
+	// the username used to authenticate against image registries.
+	RegistryUsernameEnv = "ANSIBLE_ROLE_TESTER_REGISTRY_USERNAME"
+
+	// RegistryPasswordEnv is the environment variable containing
+	// the password used to authenticate against image registries.
+	RegistryPasswordEnv = "ANSIBLE_ROLE_TESTER_REGISTRY_PASSWORD"
+
+	// RegistryEnv is an optional environment variable which limits the
+	// credentials in RegistryUsernameEnv and RegistryPasswordEnv to one registry.
+	RegistryEnv = "ANSIBLE_ROLE_TESTER_REGISTRY"
+
+	// dockerHubServer is the server address Docker uses for Docker Hub credentials.
+	dockerHubServer = "https://index.docker.io/v1/"
+)
+
+// CredentialHelper is the name of a Docker credential helper, such as
+// 'ecr-login' for docker-credential-ecr-login, which will be used to
+// retrieve registry credentials when pulling images.
+var CredentialHelper string
+
+// RegistryCredentials is a set of credentials for an image registry.
+type RegistryCredentials struct {
+	Registry string
+	Username string
+	Password string
+
+	// Source describes where the credentials were found.
+	Source string
+}
+
+// RegistryAuthError is returned when a registry refused
+// to serve an image due to missing or invalid credentials.
+type RegistryAuthError struct {
+	Registry string
+	Image    string
+	Source   string
+	Output   string
+}
+
+// Error will describe the authentication failure.
+func (e *RegistryAuthError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("authentication to registry %v failed for %v: no credentials were found, see %v, %v or 'docker login'", e.Registry, e.Image, RegistryUsernameEnv, RegistryPasswordEnv)
+	}
+	return fmt.Sprintf("authentication to registry %v failed for %v using credentials from %v: %v", e.Registry, e.Image, e.Source, strings.TrimSpace(e.Output))
+}
+
+// IsRegistryAuthError will identify if the error is a RegistryAuthError.
+func IsRegistryAuthError(err error) bool {
+	_, ok := err.(*RegistryAuthError)
+	return ok
+}
+
+// isAuthFailure will identify if the output of a docker command
+// indicates the registry has rejected the request for authentication.
+func isAuthFailure(output string) bool {
+	output = strings.ToLower(output)
+	for _, message := range []string{
+		"unauthorized",
+		"authentication required",
+		"no basic auth credentials",
+		"denied: ",
+		"access denied",
+		"incorrect username or password",
+	} {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerConfigFile returns the path to the Docker configuration file.
+func dockerConfigFile() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// dockerConfig is the subset of the Docker configuration file
+// which is relevant to registry authentication.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+// registryServer returns the server address used by Docker for a registry.
+func registryServer(registry string) string {
+	if registry == "" || registry == DefaultRegistry || registry == "index.docker.io" {
+		return dockerHubServer
+	}
+	return registry
+}
+
+// credentialHelperGet will retrieve the credentials for a registry from
+// a Docker credential helper using the credential helper protocol.
+func credentialHelperGet(helper, registry string) (*RegistryCredentials, error) {
+
+	name := "docker-credential-" + helper
+	result, err := execute(Command{
+		Name:  name,
+		Args:  []string{"get"},
+		Stdin: strings.NewReader(registryServer(registry)),
+	})
+	if err != nil && result.ExitCode == -1 {
+		return nil, fmt.Errorf("credential helper %v was not found in $PATH", name)
+	} else if err != nil {
+		return nil, fmt.Errorf("credential helper %v returned no credentials for %v", name, registry)
+	}
+
+	response := struct {
+		Username string
+		Secret   string
+	}{}
+	if err := json.Unmarshal([]byte(result.Stdout), &response); err != nil {
+		return nil, fmt.Errorf("credential helper %v returned an invalid response: %v", name, err)
+	}
+
+	return &RegistryCredentials{
+		Registry: registry,
+		Username: response.Username,
+		Password: response.Secret,
+		Source:   name,
+	}, nil
+}
+
+// RegistryCredentialsFor will find the credentials for the specified
+// registry. Sources are checked in order of precedence:
+//   - the RegistryUsernameEnv and RegistryPasswordEnv environment variables
+//   - the credential helper named by CredentialHelper
+//   - credential helpers and credentials in the Docker configuration file
+//
+// Sources which fail are logged as a warning and skipped, so the image is
+// pulled anonymously and a RegistryAuthError is only returned if the
+// registry then refuses it. Nil is returned when no credentials were found.
+func RegistryCredentialsFor(registry string) *RegistryCredentials {
+
+	if username, password := os.Getenv(RegistryUsernameEnv), os.Getenv(RegistryPasswordEnv); username != "" && password != "" {
+		if scope := os.Getenv(RegistryEnv); scope == "" || registryServer(scope) == registryServer(registry) {
+			return &RegistryCredentials{
+				Registry: registry,
+				Username: username,
+				Password: password,
+				Source:   "environment",
+			}
+		}
+	}
+
+	if CredentialHelper != "" {
+		creds, err := credentialHelperGet(CredentialHelper, registry)
+		if err != nil {
+			log.Warnln(err)
+		}
+		return creds
+	}
+
+	data, err := ioutil.ReadFile(dockerConfigFile())
+	if err != nil {
+		return nil
+	}
+
+	config := dockerConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Warnf("could not parse %v: %v", dockerConfigFile(), err)
+		return nil
+	}
+
+	server := registryServer(registry)
+	if helper, ok := config.CredHelpers[server]; ok {
+		creds, err := credentialHelperGet(helper, registry)
+		if err != nil {
+			log.Warnln(err)
+		}
+		return creds
+	}
+
+	if auth, ok := config.Auths[server]; ok && auth.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			log.Warnf("could not decode credentials for %v in %v", server, dockerConfigFile())
+		} else if parts := strings.SplitN(string(decoded), ":", 2); len(parts) == 2 {
+			return &RegistryCredentials{
+				Registry: registry,
+				Username: parts[0],
+				Password: parts[1],
+				Source:   dockerConfigFile(),
+			}
+		}
+	}
+
+	if config.CredsStore != "" {
+		if creds, err := credentialHelperGet(config.CredsStore, registry); err == nil {
+			return creds
+		}
+	}
+
+	return nil
+}
+
+// DockerConfigDir will write a temporary Docker configuration directory
+// containing only these credentials, to be used with 'docker --config'.
+// The caller is responsible for removing the directory.
+func (creds *RegistryCredentials) DockerConfigDir() (string, error) {
+
+	dir, err := ioutil.TempDir("", "ansible-role-tester-auth")
+	if err != nil {
+		return "", err
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password))
+	config := map[string]interface{}{
+		"auths": map[string]interface{}{
+			registryServer(creds.Registry): map[string]string{
+				"auth": auth,
+			},
+		},
+	}
+
+	data, _ := json.Marshal(config)
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// dockerRegistryArgs will return the arguments needed to pull or push
+// (as per command) the image with the credentials available for its
+// registry, along with a func to clean up any temporary configuration.
+func dockerRegistryArgs(command, image string, quiet bool) ([]string, *RegistryCredentials, func(), error) {
+
+	cleanup := func() {}
+	ref, err := ParseImageReference(image)
+	if err != nil {
+		return nil, nil, cleanup, err
+	}
+
+	creds := RegistryCredentialsFor(ref.Registry)
+	args := []string{}
+	if creds != nil {
+		if !quiet {
+			log.Infof("Using credentials for %v from %v", registryServer(ref.Registry), creds.Source)
+		}
+		dir, err := creds.DockerConfigDir()
+		if err != nil {
+			return nil, nil, cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		args = append(args, fmt.Sprintf("--config=%v", dir))
+	}
+
+	return append(args, command, image), creds, cleanup, nil
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRegistryCredentialsForFailures(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, env := range []string{"DOCKER_CONFIG", RegistryUsernameEnv, RegistryPasswordEnv} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+	os.Setenv("DOCKER_CONFIG", dir)
+	os.Unsetenv(RegistryUsernameEnv)
+	os.Unsetenv(RegistryPasswordEnv)
+
+	executor := CommandExecutor
+	CommandExecutor = &FakeExecutor{Respond: func(command Command) (CommandResult, error) {
+		return CommandResult{ExitCode: 1}, errors.New("exit status 1")
+	}}
+	defer func() { CommandExecutor = executor }()
+
+	helper := CredentialHelper
+	defer func() { CredentialHelper = helper }()
+
+	tests := []struct {
+		name   string
+		helper string
+		config string
+	}{
+		{"failing credential helper", "broken", ""},
+		{"failing credHelpers entry", "", `{"credHelpers": {"registry.local": "broken"}}`},
+		{"failing credsStore", "", `{"credsStore": "broken"}`},
+		{"unparseable config", "", `{"auths": `},
+		{"undecodable auth", "", `{"auths": {"registry.local": {"auth": "!"}}}`},
+	}
+
+	for _, test := range tests {
+		CredentialHelper = test.helper
+		if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(test.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if creds := RegistryCredentialsFor("registry.local"); creds != nil {
+			t.Errorf("%v: RegistryCredentialsFor() = %+v, want anonymous", test.name, creds)
+		}
+	}
+}
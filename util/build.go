@@ -0,0 +1,299 @@
+package util
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DockerfileDefault is the location of a Dockerfile relative to the role,
+// which will be built and used as the image under test when present.
+const DockerfileDefault = "tests/Dockerfile"
+
+// BuildRepository is the local repository used to tag images
+// which have been built from a Dockerfile shipped with a role.
+const BuildRepository = "ansible-role-tester/build"
+
+// DockerfilePath will return the absolute path to the Dockerfile which
+// should be built for this configuration. An explicitly configured path
+// is returned as-is (relative to HostPath when not absolute), otherwise
+// the default location is checked. An empty string is returned when
+// no Dockerfile is available.
+func (config *AnsibleConfig) DockerfilePath() string {
+
+	if config.Dockerfile != "" {
+		if filepath.IsAbs(config.Dockerfile) {
+			return config.Dockerfile
+		}
+		return filepath.Join(config.HostPath, config.Dockerfile)
+	}
+
+	path := filepath.Join(config.HostPath, DockerfileDefault)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	return ""
+}
+
+// DockerfileTag will return a deterministic image reference for the
+// given Dockerfile, derived from a hash of the file and the contents of
+// its build context so that an unchanged image will never be built twice.
+// Files excluded by the .dockerignore of the build context are not sent
+// to Docker, so they are not part of the hash.
+func DockerfileTag(path string) (string, error) {
+
+	hash := sha256.New()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(data)
+
+	context := filepath.Dir(path)
+	ignored, err := dockerignore(context)
+	if err != nil {
+		return "", err
+	}
+
+	// Files copied into the image are part of the build context, the
+	// directory containing the Dockerfile. Walk visits them in order.
+	err = filepath.Walk(context, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if rel, _ := filepath.Rel(context, file); ignored(filepath.ToSlash(rel)) {
+			return nil
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(filepath.Dir(path), file)
+		fmt.Fprintf(hash, "%v\x00%v\x00", filepath.ToSlash(rel), len(data))
+		hash.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := fmt.Sprintf("%x", hash.Sum(nil))
+	return fmt.Sprintf("%v:%v", BuildRepository, sum[:12]), nil
+}
+
+// dockerignore will return a func identifying if a path relative to the
+// build context is excluded by its .dockerignore file. Patterns match the
+// path or any of its parent directories, ** matches any number of
+// directories, and patterns starting with ! include paths again.
+func dockerignore(context string) (func(path string) bool, error) {
+
+	data, err := ioutil.ReadFile(filepath.Join(context, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return func(string) bool { return false }, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	type rule struct {
+		pattern *regexp.Regexp
+		include bool
+	}
+	rules := []rule{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		include := strings.HasPrefix(line, "!")
+		line = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(strings.TrimPrefix(line, "!"))), "/")
+
+		expr := "^"
+		for i := 0; i < len(line); i++ {
+			switch {
+			case strings.HasPrefix(line[i:], "**/"):
+				expr += "(.*/)?"
+				i += 2
+			case strings.HasPrefix(line[i:], "**"):
+				expr += ".*"
+				i++
+			case line[i] == '*':
+				expr += "[^/]*"
+			case line[i] == '?':
+				expr += "[^/]"
+			default:
+				expr += regexp.QuoteMeta(line[i : i+1])
+			}
+		}
+		pattern, err := regexp.Compile(expr + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %v: %v", line, err)
+		}
+		rules = append(rules, rule{pattern, include})
+	}
+
+	return func(path string) bool {
+		ignored := false
+		for _, r := range rules {
+			for p := path; p != "." && p != "/" && p != ""; p = filepath.ToSlash(filepath.Dir(p)) {
+				if r.pattern.MatchString(p) {
+					ignored = !r.include
+					break
+				}
+			}
+		}
+		return ignored
+	}, nil
+}
+
+// DockerfileBaseImages will return the images the Dockerfile is built
+// from, in the order of its FROM instructions. Earlier build stages,
+// scratch and images named by build arguments are not included.
+func DockerfileBaseImages(path string) ([]string, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stages := map[string]bool{"scratch": true}
+	images := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		// Options such as --platform precede the image.
+		i := 1
+		for i < len(fields) && strings.HasPrefix(fields[i], "--") {
+			i++
+		}
+		if i == len(fields) {
+			continue
+		}
+		image := fields[i]
+		if !stages[strings.ToLower(image)] && !strings.Contains(image, "$") {
+			images = append(images, image)
+		}
+		if i+2 < len(fields) && strings.EqualFold(fields[i+1], "AS") {
+			stages[strings.ToLower(fields[i+2])] = true
+		}
+	}
+
+	return images, nil
+}
+
+// dockerPullBase will pull the base image of a Dockerfile according to
+// the pull policy. When a mirror is specified the image is pulled from
+// the mirror and tagged with its original reference, so the Dockerfile
+// is built from the mirrored image without being changed.
+func dockerPullBase(image, policy, mirror string, quiet bool) error {
+
+	if mirror == "" {
+		return DockerPullPolicy(image, policy, quiet)
+	}
+
+	mirrored, err := MirrorImage(image, mirror)
+	if err != nil {
+		return err
+	}
+	if err := DockerPullPolicy(mirrored, policy, quiet); err != nil {
+		return err
+	}
+	if mirrored == image {
+		return nil
+	}
+
+	// Images cannot be tagged by digest, so the tag is used instead.
+	ref, _ := ParseImageReference(image)
+	ref.Digest = ""
+	if ref.Tag == "" {
+		ref.Tag = DefaultTag
+	}
+	tagged := ref.String()
+
+	if _, err := DockerExec([]string{
+		"tag",
+		mirrored,
+		tagged,
+	}, false); err != nil {
+		return fmt.Errorf("could not tag %v as %v: %v", mirrored, tagged, err)
+	}
+	return nil
+}
+
+// DockerImageExists will identify if the specified image
+// is available in the local image store.
+func DockerImageExists(image string) bool {
+
+	out, err := DockerExec([]string{
+		"images",
+		"--quiet",
+		image,
+	}, false)
+
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(out) != ""
+}
+
+// DockerBuild will build the Dockerfile configured for the role, if
+// there is one, and assign the resulting image to the Distribution.
+// The build context is the directory containing the Dockerfile.
+// Images which already exist for the same contents are reused. The base
+// images are pulled according to the pull policy before building, using
+// any credentials available for their registries, and from the mirror
+// registry when one is specified.
+func (dist *Distribution) DockerBuild(config *AnsibleConfig, policy, mirror string) error {
+
+	dockerfile := config.DockerfilePath()
+	if dockerfile == "" {
+		return nil
+	}
+
+	tag, err := DockerfileTag(dockerfile)
+	if err != nil {
+		return errors.New("could not read Dockerfile " + dockerfile)
+	}
+
+	if !DockerImageExists(tag) {
+		if !config.Quiet {
+			log.Printf("Building %v from %v", tag, dockerfile)
+		}
+		bases, err := DockerfileBaseImages(dockerfile)
+		if err != nil {
+			return errors.New("could not read Dockerfile " + dockerfile)
+		}
+		for _, base := range bases {
+			if err := dockerPullBase(base, policy, mirror, config.Quiet); err != nil {
+				return err
+			}
+		}
+		if _, err := DockerExec([]string{
+			"build",
+			fmt.Sprintf("--tag=%v", tag),
+			fmt.Sprintf("--file=%v", dockerfile),
+			filepath.Dir(dockerfile),
+		}, !config.Quiet); err != nil {
+			return fmt.Errorf("could not build %v: %v", dockerfile, err)
+		}
+	} else if !config.Quiet {
+		log.Infof("Using existing image %v built from %v", tag, dockerfile)
+	}
+
+	dist.Container = tag
+	return nil
+}
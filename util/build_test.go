@@ -0,0 +1,101 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDockerfileTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	write := func(path, content string) {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tag := func() string {
+		tag, err := DockerfileTag(dockerfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tag
+	}
+
+	write(dockerfile, "FROM centos:7\nCOPY certs/ /etc/pki/ca-trust/source/anchors/\n")
+	write(filepath.Join(dir, "certs", "ca.crt"), "one")
+	first := tag()
+	if !strings.HasPrefix(first, BuildRepository+":") {
+		t.Errorf("tag %v is not in %v", first, BuildRepository)
+	}
+	if tag() != first {
+		t.Error("the tag changed without any changes to the build context")
+	}
+
+	write(filepath.Join(dir, "certs", "ca.crt"), "two")
+	second := tag()
+	if second == first {
+		t.Error("the tag did not change when a file in the build context changed")
+	}
+
+	write(filepath.Join(dir, "certs", "other.crt"), "")
+	third := tag()
+	if third == second {
+		t.Error("the tag did not change when a file was added to the build context")
+	}
+
+	write(filepath.Join(dir, ".dockerignore"), "# not sent to docker\n*.yml\nartifacts\n**/*.log\n!keep.log\n")
+	ignored := tag()
+	if ignored == third {
+		t.Error("the tag did not change when .dockerignore was added")
+	}
+	for _, file := range []string{"playbook.yml", filepath.Join("artifacts", "report.yml"), filepath.Join("certs", "debug.log")} {
+		write(filepath.Join(dir, file), "changed")
+		if tag() != ignored {
+			t.Errorf("the tag changed when %v, which is excluded by .dockerignore, changed", file)
+		}
+	}
+	write(filepath.Join(dir, "keep.log"), "included")
+	if tag() == ignored {
+		t.Error("the tag did not change when a file included again by .dockerignore changed")
+	}
+}
+
+func TestDockerfileBaseImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	content := `ARG BASE=centos:7
+FROM --platform=linux/amd64 registry.local:5000/team/builder:1 AS build
+RUN make
+FROM ${BASE}
+from build as test
+FROM scratch
+FROM fubarhouse/docker-ansible:bionic
+COPY --from=build /out /out
+`
+	if err := ioutil.WriteFile(dockerfile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := DockerfileBaseImages(dockerfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"registry.local:5000/team/builder:1", "fubarhouse/docker-ansible:bionic"}
+	if strings.Join(images, ",") != strings.Join(want, ",") {
+		t.Errorf("DockerfileBaseImages() = %v, want %v", images, want)
+	}
+}
@@ -2,12 +2,9 @@ package util
 
 import (
 	"errors"
-	"strings"
 
 	"fmt"
 	"reflect"
-
-	log "github.com/sirupsen/logrus"
 )
 
 // A Distribution declares the options to
@@ -15,36 +12,41 @@ import (
 type Distribution struct {
 
 	// CID is the name/id of the container.
-	CID string
+	CID string `json:"cid" yaml:"cid"`
 
 	// Name is the identifying name of the distribution
-	Name string
+	Name string `json:"name" yaml:"name"`
 
 	// Privileged is a boolean to indicate to use privileged
-	Privileged bool
+	Privileged bool `json:"privileged" yaml:"privileged"`
 
 	// The fully qualified container name in the format:
 	// name/image:version - ie fubarhouse/docker-ansible:bionic
-	Container string
+	Container string `json:"container" yaml:"container"`
 
 	// User is the user associated to the image file, used
 	// when searching for a user from the command line tool.
-	User string
+	User string `json:"user" yaml:"user"`
 
 	// Distro is the distro associated to the image file, used
 	// when searching for a distro from the command line tool.
-	Distro string
+	Distro string `json:"distro" yaml:"distro"`
 
 	// Family associated to this distribution.
-	Family Family
+	Family Family `json:"family" yaml:"family"`
+
+	// Digest pins the image to a content digest, ie sha256:..., so the
+	// same image is used regardless of where the tag points. It is not
+	// pinned when empty.
+	Digest string `json:"digest" yaml:"digest"`
 }
 
 // Family is a set of characteristics describing a family of linux distributions.
 // For example, ubuntu, centos, debian or fedora.
 type Family struct {
-	Name       string
-	Initialise string
-	Volume     string
+	Name       string `json:"name" yaml:"name"`
+	Initialise string `json:"initialise" yaml:"initialise"`
+	Volume     string `json:"volume" yaml:"volume"`
 }
 
 // CentOS Family Distribution Identifier
@@ -84,6 +86,7 @@ var CentOS6 = Distribution{
 	"fubarhouse",
 	"centos6",
 	CentOS,
+	"",
 }
 
 // CentOS7 Distribution declaration
@@ -95,6 +98,7 @@ var CentOS7 = Distribution{
 	"fubarhouse",
 	"centos7",
 	CentOS,
+	"",
 }
 
 // DebianWheezy Distribution declaration
@@ -106,6 +110,7 @@ var DebianWheezy = Distribution{
 	"fubarhouse",
 	"debian7",
 	Debian,
+	"",
 }
 
 // DebianJessie Distribution declaration
@@ -117,6 +122,7 @@ var DebianJessie = Distribution{
 	"fubarhouse",
 	"debian8",
 	Debian,
+	"",
 }
 
 // DebianStretch Distribution declaration
@@ -128,6 +134,7 @@ var DebianStretch = Distribution{
 	"fubarhouse",
 	"debian9",
 	Debian,
+	"",
 }
 
 // DebianBuster Distribution declaration
@@ -139,6 +146,7 @@ var DebianBuster = Distribution{
 	"fubarhouse",
 	"debian10",
 	Debian,
+	"",
 }
 
 // Fedora24 Distribution declaration
@@ -150,6 +158,7 @@ var Fedora24 = Distribution{
 	"fubarhouse",
 	"fedora24",
 	Fedora,
+	"",
 }
 
 // Fedora25 Distribution declaration
@@ -161,6 +170,7 @@ var Fedora25 = Distribution{
 	"fubarhouse",
 	"fedora25",
 	Fedora,
+	"",
 }
 
 // Fedora26 Distribution declaration
@@ -172,6 +182,7 @@ var Fedora26 = Distribution{
 	"fubarhouse",
 	"fedora26",
 	Fedora,
+	"",
 }
 
 // Fedora27 Distribution declaration
@@ -183,6 +194,7 @@ var Fedora27 = Distribution{
 	"fubarhouse",
 	"fedora27",
 	Fedora,
+	"",
 }
 
 // Fedora28 Distribution declaration
@@ -194,6 +206,7 @@ var Fedora28 = Distribution{
 	"fubarhouse",
 	"fedora28",
 	Fedora,
+	"",
 }
 
 // Fedora29 Distribution declaration
@@ -205,6 +218,7 @@ var Fedora29 = Distribution{
 	"fubarhouse",
 	"fedora29",
 	Fedora,
+	"",
 }
 
 // Fedora30 Distribution declaration
@@ -216,6 +230,7 @@ var Fedora30 = Distribution{
 	"fubarhouse",
 	"fedora30",
 	Fedora,
+	"",
 }
 
 // Fedora31 Distribution declaration
@@ -227,6 +242,7 @@ var Fedora31 = Distribution{
 	"fubarhouse",
 	"fedora31",
 	Fedora,
+	"",
 }
 
 // Ubuntu1204 Distribution declaration
@@ -238,6 +254,7 @@ var Ubuntu1204 = Distribution{
 	"fubarhouse",
 	"ubuntu1204",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1210 Distribution declaration
@@ -249,6 +266,7 @@ var Ubuntu1210 = Distribution{
 	"fubarhouse",
 	"ubuntu1210",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1304 Distribution declaration
@@ -260,6 +278,7 @@ var Ubuntu1304 = Distribution{
 	"fubarhouse",
 	"ubuntu1304",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1310 Distribution declaration
@@ -271,6 +290,7 @@ var Ubuntu1310 = Distribution{
 	"fubarhouse",
 	"ubuntu1310",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1404 Distribution declaration
@@ -282,6 +302,7 @@ var Ubuntu1404 = Distribution{
 	"fubarhouse",
 	"ubuntu1404",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1410 Distribution declaration
@@ -293,6 +314,7 @@ var Ubuntu1410 = Distribution{
 	"fubarhouse",
 	"ubuntu1410",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1504 Distribution declaration
@@ -304,6 +326,7 @@ var Ubuntu1504 = Distribution{
 	"fubarhouse",
 	"ubuntu1504",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1510 Distribution declaration
@@ -315,6 +338,7 @@ var Ubuntu1510 = Distribution{
 	"fubarhouse",
 	"ubuntu1510",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1604 Distribution declaration
@@ -326,6 +350,7 @@ var Ubuntu1604 = Distribution{
 	"fubarhouse",
 	"ubuntu1604",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1610 Distribution declaration
@@ -337,6 +362,7 @@ var Ubuntu1610 = Distribution{
 	"fubarhouse",
 	"ubuntu1610",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1704 Distribution declaration
@@ -348,6 +374,7 @@ var Ubuntu1704 = Distribution{
 	"fubarhouse",
 	"ubuntu1704",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1710 Distribution declaration
@@ -359,6 +386,7 @@ var Ubuntu1710 = Distribution{
 	"fubarhouse",
 	"ubuntu1710",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1804 Distribution declaration
@@ -370,6 +398,7 @@ var Ubuntu1804 = Distribution{
 	"fubarhouse",
 	"ubuntu1804",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1810 Distribution declaration
@@ -381,6 +410,7 @@ var Ubuntu1810 = Distribution{
 	"fubarhouse",
 	"ubuntu1810",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu1904 Distribution declaration
@@ -392,6 +422,7 @@ var Ubuntu1904 = Distribution{
 	"fubarhouse",
 	"ubuntu1904",
 	Ubuntu,
+	"",
 }
 
 // Ubuntu2004 Distribution declaration
@@ -403,6 +434,7 @@ var Ubuntu2004 = Distribution{
 	"fubarhouse",
 	"ubuntu2004",
 	Ubuntu,
+	"",
 }
 
 // JeffCentOS6 Distribution declaration
@@ -414,6 +446,7 @@ var JeffCentOS6 = Distribution{
 	"geerlingguy",
 	"centos6",
 	CentOS,
+	"",
 }
 
 // JeffCentOS7 Distribution declaration
@@ -425,6 +458,7 @@ var JeffCentOS7 = Distribution{
 	"geerlingguy",
 	"centos7",
 	CentOS,
+	"",
 }
 
 // JeffUbuntu1204 Distribution declaration
@@ -436,6 +470,7 @@ var JeffUbuntu1204 = Distribution{
 	"geerlingguy",
 	"ubuntu1204",
 	Ubuntu,
+	"",
 }
 
 // JeffUbuntu1404 Distribution declaration
@@ -447,6 +482,7 @@ var JeffUbuntu1404 = Distribution{
 	"geerlingguy",
 	"ubuntu1404",
 	Ubuntu,
+	"",
 }
 
 // JeffUbuntu1604 Distribution declaration
@@ -458,6 +494,7 @@ var JeffUbuntu1604 = Distribution{
 	"geerlingguy",
 	"ubuntu1604",
 	Ubuntu,
+	"",
 }
 
 // JeffUbuntu1804 Distribution declaration
@@ -469,6 +506,7 @@ var JeffUbuntu1804 = Distribution{
 	"geerlingguy",
 	"ubuntu1804",
 	Ubuntu,
+	"",
 }
 
 // JeffDebian8 Distribution declaration
@@ -480,6 +518,7 @@ var JeffDebian8 = Distribution{
 	"geerlingguy",
 	"debian8",
 	Debian,
+	"",
 }
 
 // JeffDebian9 Distribution declaration
@@ -491,6 +530,7 @@ var JeffDebian9 = Distribution{
 	"geerlingguy",
 	"debian9",
 	Debian,
+	"",
 }
 
 // JeffFedora24 Distribution declaration
@@ -502,6 +542,7 @@ var JeffFedora24 = Distribution{
 	"geerlingguy",
 	"fedora24",
 	Fedora,
+	"",
 }
 
 // JeffFedora27 Distribution declaration
@@ -513,6 +554,7 @@ var JeffFedora27 = Distribution{
 	"geerlingguy",
 	"fedora27",
 	Fedora,
+	"",
 }
 
 // Distributions is a slice of all distributions listed above.
@@ -618,10 +660,17 @@ func CustomFamilyValueGet(family *Family, key string) (string, error) {
 // cannot be found.
 func GetDistribution(container, target, init, volume, user, distro string) (Distribution, error) {
 
+	// Invalid image references can never be matched or pulled.
+	if container != "" {
+		if _, err := ParseImageReference(container); err != nil {
+			return Distribution{}, err
+		}
+	}
+
 	// We will search for the exact container.
 	for _, dist := range Distributions {
 		// Check for explicit matches using image.
-		if dist.Container == container {
+		if container != "" && SameImage(dist.Container, container) {
 			return dist, nil
 		}
 		// Check for explicit matches for user and distro.
@@ -630,15 +679,49 @@ func GetDistribution(container, target, init, volume, user, distro string) (Dist
 		}
 	}
 
-	c, _ := DockerExec([]string{
-		"images",
-		container,
-	}, false)
+	return Distribution{},
+		errors.New("could not find matching distribution")
+}
 
-	if !strings.Contains(c, container) {
-		log.Errorf("no valid image was found for '%v'\n", container)
+// FilterDistributions will return every Distribution matching any of the
+// specified users and any of the specified distros. An empty list of users
+// or distros will match all of them.
+func FilterDistributions(users, distros []string) []Distribution {
+
+	matches := func(value string, filter []string) bool {
+		if len(filter) == 0 {
+			return true
+		}
+		for _, item := range filter {
+			if item == value {
+				return true
+			}
+		}
+		return false
 	}
 
-	return Distribution{},
-		errors.New("could not find matching distribution")
+	result := []Distribution{}
+	for _, dist := range Distributions {
+		if matches(dist.User, users) && matches(dist.Distro, distros) {
+			result = append(result, dist)
+		}
+	}
+
+	return result
+}
+
+// DistributionImages will return the unique images used by the
+// specified distributions, in the order they were declared.
+func DistributionImages(dists []Distribution) []string {
+
+	seen := map[string]bool{}
+	images := []string{}
+	for _, dist := range dists {
+		if !seen[dist.Container] {
+			seen[dist.Container] = true
+			images = append(images, dist.Container)
+		}
+	}
+
+	return images
 }
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"io/ioutil"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestGetDistribution(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	tests := []struct {
+		name      string
+		container string
+		user      string
+		distro    string
+		want      string
+		wantErr   bool
+	}{
+		{"user and distro", "", "fubarhouse", "ubuntu1804", "fubarhouse/docker-ansible:bionic", false},
+		{"image", "fubarhouse/docker-ansible:bionic", "", "", "fubarhouse/docker-ansible:bionic", false},
+		{"fully qualified image", "docker.io/fubarhouse/docker-ansible:bionic", "", "", "fubarhouse/docker-ansible:bionic", false},
+		{"unknown distro", "", "fubarhouse", "plan9", "", true},
+		{"invalid image", "Not An Image", "", "", "", true},
+	}
+
+	for _, test := range tests {
+		dist, err := GetDistribution(test.container, "", "/sbin/init", "/sys/fs/cgroup:/sys/fs/cgroup:ro", test.user, test.distro)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%v: got error %v, want error %v", test.name, err, test.wantErr)
+		}
+		if dist.Container != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, dist.Container, test.want)
+		}
+	}
+}
@@ -1,15 +1,10 @@
 package util
 
 import (
-	"bytes"
-	"io"
-	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"fmt"
-	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -19,45 +14,25 @@ import (
 // and use the input args as arguments for that process.
 // You can request output be printed using the bool stdout.
 func DockerExec(args []string, stdout bool) (string, error) {
+	out, _, err := DockerExecOutput(args, stdout)
+	return out, err
+}
 
-	// Generate the command, based on input.
-	cmd := exec.Cmd{}
-	cmd.Path = docker
-	cmd.Args = []string{docker}
-
-	// Add our arguments to the command.
-	cmd.Args = append(cmd.Args, args...)
-
-	// If configured, print to os.Stdout.
-	if stdout {
-		cmd.Stdout = os.Stdout
-		cmd.Stdin = os.Stdin
-		cmd.Stderr = os.Stderr
-	}
-
-	// Create a buffer for the output.
-	var out bytes.Buffer
-	multi := io.MultiWriter(&out)
-
-	//if stdout && !noOutput {
-	if stdout {
-		multi = io.MultiWriter(&out, os.Stdout)
-	}
-
-	// Assign the output to the writer.
-	cmd.Stdout = multi
-
-	// Check the errors, return as needed.
-	var wg sync.WaitGroup
-	wg.Add(1)
-	if err := cmd.Run(); err != nil {
+// DockerExecOutput will execute a command to the docker binary in the
+// same way as DockerExec, additionally returning the error output of the
+// process so failures can be inspected.
+func DockerExecOutput(args []string, stdout bool) (string, string, error) {
+
+	result, err := execute(Command{
+		Name:   "docker",
+		Args:   args,
+		Stream: stdout,
+	})
+	if err != nil {
 		log.Errorln(err)
-		return out.String(), err
 	}
-	wg.Done()
 
-	// Return out output as a string.
-	return out.String(), nil
+	return result.Stdout, result.Stderr, err
 }
 
 // DockerCheck checks if the specified container is running.
@@ -115,17 +90,42 @@ func buildDockerArgs(dist *Distribution, config *AnsibleConfig, report *AnsibleR
 		report.Docker.Volumes = append(report.Docker.Volumes, fmt.Sprintf("%s:%v", config.LibraryPath, "/root/.ansible/plugins/modules"))
 	}
 
-	// Mount the volumes!
-	VolumeMap := map[string]string{}
-	for i, Volume := range report.Docker.Volumes {
-		if VolumeMap[Volume] != Volume {
-			// The Volume entry was not found in the map.
-			VolumeMap[Volume] = Volume
-			dockerArgs = append(dockerArgs, fmt.Sprintf("--volume=%v", Volume))
-		} else {
-			// The volume entry was found in the map.
-			// We need to update our slice to reflect this duplication.
-			report.Docker.Volumes = append(report.Docker.Volumes[:i], report.Docker.Volumes[i+1:]...)
+	if config.PackageCache {
+		report.Docker.Volumes = append(report.Docker.Volumes, dist.PackageCacheVolumes()...)
+	}
+
+	if config.GalaxyCache != "" {
+		report.Docker.Volumes = append(report.Docker.Volumes, fmt.Sprintf("%s:%v", config.GalaxyCache, GalaxyCacheMount))
+	}
+
+	// Mount the volumes, once each.
+	report.Docker.Volumes = uniqueStrings(report.Docker.Volumes)
+	for _, volume := range report.Docker.Volumes {
+		dockerArgs = append(dockerArgs, fmt.Sprintf("--volume=%v", volume))
+	}
+
+	if config.Hostname != "" {
+		dockerArgs = append(dockerArgs, fmt.Sprintf("--hostname=%v", config.Hostname))
+	}
+
+	for _, host := range config.ExtraHosts {
+		dockerArgs = append(dockerArgs, fmt.Sprintf("--add-host=%v", host))
+	}
+
+	for _, env := range config.Env {
+		dockerArgs = append(dockerArgs, fmt.Sprintf("--env=%v", env))
+	}
+
+	if config.Network != "" {
+		dockerArgs = append(dockerArgs, fmt.Sprintf("--network=%v", config.Network))
+		if config.Hostname != "" {
+			dockerArgs = append(dockerArgs, fmt.Sprintf("--network-alias=%v", config.Hostname))
+		}
+	}
+
+	if config.GalaxyCache != "" {
+		for _, env := range GalaxyCacheEnv() {
+			dockerArgs = append(dockerArgs, fmt.Sprintf("--env=%v", env))
 		}
 	}
 
@@ -139,6 +139,20 @@ func buildDockerArgs(dist *Distribution, config *AnsibleConfig, report *AnsibleR
 	return dockerArgs
 }
 
+// uniqueStrings will return the items without duplicates, in the
+// order they first appear. The input slice is not modified.
+func uniqueStrings(items []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
 // DockerRun will launch a new container (containerID) using
 // the fields in a AnsibleConfig struct.
 func (dist *Distribution) DockerRun(config *AnsibleConfig, report *AnsibleReport) bool {
@@ -152,8 +166,24 @@ func (dist *Distribution) DockerRun(config *AnsibleConfig, report *AnsibleReport
 			log.Printf("Running %v", dist.CID)
 		}
 
-		if _, err := DockerExec(buildDockerArgs(dist, config, report), !config.Quiet); err != nil {
+		if config.PackageCache {
+			if err := dist.packageCacheCreate(); err != nil {
+				log.Errorln(err)
+			}
+		}
+
+		if config.Pool > 0 && dist.PoolTake(config, report) {
+			// The container has been taken from the pool.
+		} else if _, err := DockerExec(buildDockerArgs(dist, config, report), !config.Quiet); err != nil {
 			log.Errorln(err)
+		} else if config.PackageCache {
+			dist.PackageCacheConfigure(config)
+		}
+
+		// Replace the container taken from the pool, or
+		// fill the pool for the first time.
+		if config.Pool > 0 {
+			dist.PoolFill(config)
 		}
 
 	} else {
@@ -198,6 +228,9 @@ func (dist *Distribution) DockerKill(quiet bool) bool {
 			}
 		}
 
+		// Sidecars are removed even if the container has already stopped.
+		dist.sidecarsKill(quiet)
+
 	} else {
 		if !quiet {
 			log.Errorln("container name was not specified")
@@ -0,0 +1,170 @@
+package util
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// contains will return true if the arguments contain the argument.
+func contains(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBuildDockerArgs(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dist := Ubuntu1804
+	dist.CID = "art-test"
+	newConfig := func() AnsibleConfig {
+		return AnsibleConfig{
+			HostPath:   "/home/user/ansible-role-example",
+			RemotePath: "/etc/ansible/roles/role_under_test",
+		}
+	}
+
+	t.Run("container is named and detached", func(t *testing.T) {
+		config := newConfig()
+		args := buildDockerArgs(&dist, &config, &AnsibleReport{})
+		if want := []string{"run", "--detach", "--name=art-test"}; !reflect.DeepEqual(args[:3], want) {
+			t.Errorf("got %v, want %v", args[:3], want)
+		}
+	})
+
+	t.Run("image and initialise command are last", func(t *testing.T) {
+		config := newConfig()
+		args := buildDockerArgs(&dist, &config, &AnsibleReport{})
+		if want := []string{"fubarhouse/docker-ansible:bionic", "/sbin/init"}; !reflect.DeepEqual(args[len(args)-2:], want) {
+			t.Errorf("got %v, want %v", args[len(args)-2:], want)
+		}
+		if !contains(args, "--privileged") {
+			t.Errorf("%v is not privileged", args)
+		}
+	})
+
+	t.Run("role is mounted at the remote path and by name", func(t *testing.T) {
+		config := newConfig()
+		report := AnsibleReport{}
+		args := buildDockerArgs(&dist, &config, &report)
+		for _, volume := range []string{
+			"--volume=/sys/fs/cgroup:/sys/fs/cgroup:ro",
+			"--volume=/home/user/ansible-role-example:/etc/ansible/roles/role_under_test",
+			"--volume=/home/user/ansible-role-example:/etc/ansible/roles/ansible-role-example",
+		} {
+			if !contains(args, volume) {
+				t.Errorf("%v does not contain %v", args, volume)
+			}
+		}
+		if len(report.Docker.Volumes) != 3 {
+			t.Errorf("got %v volumes in the report, want 3", len(report.Docker.Volumes))
+		}
+	})
+
+	t.Run("role is not mounted by name for remote runs", func(t *testing.T) {
+		config := newConfig()
+		config.Remote = true
+		args := buildDockerArgs(&dist, &config, &AnsibleReport{})
+		if contains(args, "--volume=/home/user/ansible-role-example:/etc/ansible/roles/ansible-role-example") {
+			t.Errorf("%v mounts the role by name", args)
+		}
+	})
+
+	t.Run("duplicate volumes are mounted once", func(t *testing.T) {
+		config := newConfig()
+		config.RemotePath = "/etc/ansible/roles/ansible-role-example"
+		report := AnsibleReport{}
+		args := buildDockerArgs(&dist, &config, &report)
+		mounts := 0
+		for _, arg := range args {
+			if arg == "--volume=/home/user/ansible-role-example:/etc/ansible/roles/ansible-role-example" {
+				mounts++
+			}
+		}
+		if mounts != 1 {
+			t.Errorf("the role was mounted %v times, want 1", mounts)
+		}
+		if len(report.Docker.Volumes) != 2 {
+			t.Errorf("got %v volumes in the report, want 2", len(report.Docker.Volumes))
+		}
+	})
+
+	t.Run("volumes of an earlier run are mounted once", func(t *testing.T) {
+		config := newConfig()
+		report := AnsibleReport{}
+		buildDockerArgs(&dist, &config, &report)
+		args := buildDockerArgs(&dist, &config, &report)
+		mounts := 0
+		for _, arg := range args {
+			if arg == "--volume=/home/user/ansible-role-example:/etc/ansible/roles/role_under_test" {
+				mounts++
+			}
+		}
+		if mounts != 1 {
+			t.Errorf("the role was mounted %v times, want 1", mounts)
+		}
+		if len(report.Docker.Volumes) != 3 {
+			t.Errorf("got %v volumes in the report, want 3", len(report.Docker.Volumes))
+		}
+	})
+
+	t.Run("extra roles and libraries are mounted", func(t *testing.T) {
+		config := newConfig()
+		config.ExtraRolesPath = "/home/user/roles"
+		config.LibraryPath = "/home/user/library"
+		args := buildDockerArgs(&dist, &config, &AnsibleReport{})
+		for _, volume := range []string{
+			"--volume=/home/user/roles:/root/.ansible/roles",
+			"--volume=/home/user/library:/root/.ansible/plugins/modules",
+		} {
+			if !contains(args, volume) {
+				t.Errorf("%v does not contain %v", args, volume)
+			}
+		}
+	})
+
+	t.Run("networks are joined with the hostname as an alias", func(t *testing.T) {
+		config := newConfig()
+		config.Network = "art-test-network"
+		config.Hostname = "web"
+		args := buildDockerArgs(&dist, &config, &AnsibleReport{})
+		for _, arg := range []string{"--network=art-test-network", "--network-alias=web", "--hostname=web"} {
+			if !contains(args, arg) {
+				t.Errorf("%v does not contain %v", args, arg)
+			}
+		}
+	})
+}
+
+func TestDockerExec(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	fake := &FakeExecutor{
+		Respond: func(command Command) (CommandResult, error) {
+			return CommandResult{Stdout: "true\n"}, nil
+		},
+	}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	out, err := DockerExec([]string{"ps", "--all"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "true\n" {
+		t.Errorf("got output %q, want %q", out, "true\n")
+	}
+	if len(fake.Commands) != 1 {
+		t.Fatalf("got %v commands, want 1", len(fake.Commands))
+	}
+	if got := fake.Commands[0].String(); got != "docker ps --all" {
+		t.Errorf("got command %q, want %q", got, "docker ps --all")
+	}
+}
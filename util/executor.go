@@ -0,0 +1,173 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Command is an external command for an Executor to run.
+type Command struct {
+	// Name is the executable, which is found in $PATH.
+	Name string
+
+	// Args are the arguments to the executable.
+	Args []string
+
+	// Dir is the working directory, or the current directory when empty.
+	Dir string
+
+	// Env are additional environment variables in the form KEY=value.
+	Env []string
+
+	// Stdin is the input of the command, or os.Stdin when streaming.
+	Stdin io.Reader
+
+	// Stream indicates the output should also be written
+	// to CommandStdout and os.Stderr as the command runs.
+	Stream bool
+
+	// Detach indicates the command should be started without waiting for
+	// it to exit, so it keeps running after the program has exited. Only
+	// an error starting the command is returned, and its output is discarded.
+	Detach bool
+}
+
+// String will return the command as it would be typed in a shell.
+func (command Command) String() string {
+	words := []string{command.Name}
+	for _, arg := range command.Args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"$&|;<>*?()[]{}\\`") {
+			arg = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
+
+// CommandResult is the outcome of a Command.
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+}
+
+// Executor runs external commands. All docker, ansible and git commands
+// are run by CommandExecutor, which can be replaced so they are not run.
+type Executor interface {
+	Execute(command Command) (CommandResult, error)
+}
+
+// CommandExecutor is the Executor used to run external commands.
+var CommandExecutor Executor = &ExecExecutor{}
+
+// CommandStdout is where the output of commands is streamed to, which
+// can be replaced so that it does not mix with other output on os.Stdout.
+var CommandStdout io.Writer = os.Stdout
+
+// ExecExecutor is an Executor which runs commands on the host.
+type ExecExecutor struct {
+	// Context stops the command which is running when it is done.
+	// Commands are never stopped when it is nil.
+	Context context.Context
+}
+
+// Execute will run the command, returning an error if it
+// could not be started or exited with a non-zero code.
+func (e *ExecExecutor) Execute(command Command) (CommandResult, error) {
+
+	result := CommandResult{}
+
+	path, err := exec.LookPath(command.Name)
+	if err != nil {
+		result.ExitCode = -1
+		return result, fmt.Errorf("executable '%v' was not found in $PATH", command.Name)
+	}
+
+	// Generate the command, based on input.
+	cmd := exec.Command(path, command.Args...)
+	if e.Context != nil && !command.Detach {
+		cmd = exec.CommandContext(e.Context, path, command.Args...)
+	}
+	cmd.Dir = command.Dir
+	if len(command.Env) > 0 {
+		cmd.Env = append(os.Environ(), command.Env...)
+	}
+
+	if command.Detach {
+		if err := cmd.Start(); err != nil {
+			result.ExitCode = -1
+			return result, err
+		}
+		// Release the process once it exits, while the program is running.
+		go cmd.Wait()
+		return result, nil
+	}
+
+	cmd.Stdin = command.Stdin
+	if cmd.Stdin == nil && command.Stream {
+		cmd.Stdin = os.Stdin
+	}
+
+	// Create a buffer for the output, printing it as configured.
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if command.Stream {
+		cmd.Stdout = io.MultiWriter(&out, CommandStdout)
+		cmd.Stderr = io.MultiWriter(&errOut, os.Stderr)
+	}
+
+	start := time.Now()
+	err = cmd.Run()
+	result.Duration = time.Since(start)
+	result.Stdout = out.String()
+	result.Stderr = errOut.String()
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		result.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		result.ExitCode = -1
+	}
+
+	return result, err
+}
+
+// FakeExecutor is an Executor which records commands without running
+// them, for testing. Respond is called for each command when it is set,
+// otherwise every command succeeds with no output.
+type FakeExecutor struct {
+	Commands []Command
+	Respond  func(command Command) (CommandResult, error)
+
+	mu sync.Mutex
+}
+
+// Execute will record the command and return the result of Respond.
+func (f *FakeExecutor) Execute(command Command) (CommandResult, error) {
+	f.mu.Lock()
+	f.Commands = append(f.Commands, command)
+	f.mu.Unlock()
+
+	if f.Respond != nil {
+		return f.Respond(command)
+	}
+	return CommandResult{}, nil
+}
+
+// execute will run the command with CommandExecutor, recording
+// its exit code for the stage in progress if it fails.
+func execute(command Command) (CommandResult, error) {
+	result, err := CommandExecutor.Execute(command)
+	if result.ExitCode != 0 {
+		stageFailed(command, result)
+	}
+	return result, err
+}
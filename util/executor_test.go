@@ -0,0 +1,50 @@
+package util
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExecExecutorContext(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	executor := &ExecExecutor{Context: ctx}
+	if _, err := executor.Execute(Command{Name: "sleep", Args: []string{"10"}}); err == nil {
+		t.Error("a cancelled command did not return an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the command was not stopped when the context was cancelled, it ran for %v", elapsed)
+	}
+}
+
+func TestExecExecutorDetach(t *testing.T) {
+	dir, err := ioutil.TempDir("", "executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "done")
+	start := time.Now()
+	executor := &ExecExecutor{}
+	if _, err := executor.Execute(Command{Name: "sh", Args: []string{"-c", "sleep 1 && touch " + file}, Detach: true}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("the detached command was waited for, it returned after %v", elapsed)
+	}
+
+	for i := 0; i < 50 && !fileExists(file); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !fileExists(file) {
+		t.Error("the detached command did not run")
+	}
+}
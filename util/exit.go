@@ -4,8 +4,10 @@ package util
 var (
 	OKCode                 = 0
 	DockerRunCode          = 2
+	RegistryAuthCode       = 3
 	AnsibleSyntaxCode      = 10
 	AnsibleRunCode         = 11
 	AnsibleIdempotenceCode = 12
+	AnsiblePrepareCode     = 13
 	NotARoleCode           = 20
 )
@@ -0,0 +1,136 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FixturesHost is the hostname the fixture server is always
+// reachable by from the container, ie http://fixtures/file.tar.gz
+const FixturesHost = "fixtures"
+
+// FixturesURLEnv is the environment variable in the container which
+// contains the URL of the fixture server, including its port.
+const FixturesURLEnv = "ANSIBLE_ROLE_TESTER_FIXTURES_URL"
+
+// FixtureServer is an HTTP file server running on the host which serves
+// a directory of fixtures to the container, so downloads made by a role
+// during tests can be satisfied without internet access.
+type FixtureServer struct {
+
+	// Dir is the directory being served.
+	Dir string
+
+	// Hosts are the hostnames which resolve to the
+	// fixture server from inside the container.
+	Hosts []string
+
+	// Port is the port the fixture server is listening on.
+	Port int
+
+	server   *http.Server
+	listener net.Listener
+}
+
+// statusRecorder records the status of a response for logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader will record the status before writing it.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// fixturesAddress will return the address of the host which containers
+// reach with host-gateway, which is the gateway of the default bridge
+// network. The loopback address is returned when it cannot be found.
+func fixturesAddress() string {
+	out, err := DockerExec([]string{
+		"network",
+		"inspect",
+		"bridge",
+		"--format",
+		"{{range .IPAM.Config}}{{.Gateway}}{{end}}",
+	}, false)
+	if ip := net.ParseIP(strings.TrimSpace(out)); err == nil && ip != nil {
+		return ip.String()
+	}
+	return "127.0.0.1"
+}
+
+// NewFixtureServer will start serving dir on the address of the host
+// which is reachable from containers, on the specified port or on an
+// ephemeral port when it is zero. Requests for each of the hosts will
+// be served, and the URL of the server is available to the container
+// in FixturesURLEnv.
+func NewFixtureServer(dir string, port int, hosts []string, quiet bool) (*FixtureServer, error) {
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("fixtures directory %v does not exist", dir)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(fixturesAddress(), fmt.Sprint(port)))
+	if err != nil {
+		return nil, fmt.Errorf("could not start fixture server: %v", err)
+	}
+
+	files := http.FileServer(http.Dir(dir))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{w, http.StatusOK}
+		files.ServeHTTP(recorder, r)
+		if recorder.status >= 400 {
+			log.Warnf("Fixture server: %v %v%v returned %v", r.Method, r.Host, r.URL.Path, recorder.status)
+		} else if !quiet {
+			log.Infof("Fixture server: %v %v%v", r.Method, r.Host, r.URL.Path)
+		}
+	})
+
+	fixtures := &FixtureServer{
+		Dir:      dir,
+		Hosts:    append([]string{FixturesHost}, hosts...),
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		server:   &http.Server{Handler: handler},
+		listener: listener,
+	}
+
+	go fixtures.server.Serve(listener)
+
+	if !quiet {
+		log.Printf("Serving fixtures from %v on %v", dir, listener.Addr())
+	}
+
+	return fixtures, nil
+}
+
+// ExtraHosts will return the host entries for the container which
+// resolve each of the fixture hostnames to the Docker host.
+func (fixtures *FixtureServer) ExtraHosts() []string {
+	hosts := []string{}
+	for _, host := range fixtures.Hosts {
+		hosts = append(hosts, fmt.Sprintf("%v:host-gateway", host))
+	}
+	return hosts
+}
+
+// Env will return the environment for the container
+// which contains the URL of the fixture server.
+func (fixtures *FixtureServer) Env() []string {
+	url := "http://" + FixturesHost
+	if fixtures.Port != 80 {
+		url = fmt.Sprintf("%v:%v", url, fixtures.Port)
+	}
+	return []string{fmt.Sprintf("%v=%v", FixturesURLEnv, url)}
+}
+
+// Close will stop the fixture server.
+func (fixtures *FixtureServer) Close() error {
+	return fixtures.server.Close()
+}
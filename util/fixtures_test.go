@@ -0,0 +1,58 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestFixtureServer(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "app-1.0.tar.gz"), []byte("app"), 0644)
+
+	// The bridge network cannot be inspected, so the loopback address is used.
+	executor := CommandExecutor
+	CommandExecutor = &FakeExecutor{}
+	defer func() { CommandExecutor = executor }()
+
+	server, err := NewFixtureServer(dir, 0, []string{"releases.example.com"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	if server.Port == 0 {
+		t.Fatal("the fixture server is not listening on an ephemeral port")
+	}
+	if addr := server.listener.Addr().String(); addr != fmt.Sprintf("127.0.0.1:%v", server.Port) {
+		t.Errorf("the fixture server is listening on %v, want the loopback address", addr)
+	}
+
+	response, err := http.Get(fmt.Sprintf("http://127.0.0.1:%v/app-1.0.tar.gz", server.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if body, _ := ioutil.ReadAll(response.Body); string(body) != "app" {
+		t.Errorf("got %q, want %q", body, "app")
+	}
+
+	want := fmt.Sprintf("%v=http://fixtures:%v", FixturesURLEnv, server.Port)
+	if env := server.Env(); len(env) != 1 || env[0] != want {
+		t.Errorf("Env() = %v, want %v", env, want)
+	}
+	if hosts := server.ExtraHosts(); len(hosts) != 2 || hosts[1] != "releases.example.com:host-gateway" {
+		t.Errorf("ExtraHosts() = %v", hosts)
+	}
+}
@@ -0,0 +1,450 @@
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// GalaxyCacheMount is the location the galaxy cache
+	// for the requirements is mounted to in the container.
+	GalaxyCacheMount = "/opt/ansible-role-tester/galaxy"
+
+	// galaxyCacheComplete is the file written to a galaxy cache
+	// once all requirements have been successfully installed.
+	galaxyCacheComplete = ".complete"
+
+	// galaxyCacheRequirements is the copy of the requirements file
+	// kept in the galaxy cache, which is installed from in the container.
+	galaxyCacheRequirements = "requirements.yml"
+)
+
+// galaxyCacheRegexp matches the directory name of a galaxy cache,
+// which is the start of the hash of its requirements file.
+var galaxyCacheRegexp = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// CacheRoot will return the directory used for caches on the host,
+// which is $XDG_CACHE_HOME/ansible-role-tester or ~/.cache/ansible-role-tester.
+func CacheRoot() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "ansible-role-tester")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "ansible-role-tester")
+}
+
+// GalaxyCacheRoot will return the default directory for galaxy caches.
+func GalaxyCacheRoot() string {
+	return filepath.Join(CacheRoot(), "galaxy")
+}
+
+// hostFilePath will return the path on the host to a file of the
+// configuration before it is mapped, which is relative to HostPath
+// or otherwise relative to the working directory.
+func hostFilePath(config *AnsibleConfig, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if joined := filepath.Join(config.HostPath, path); fileExists(joined) {
+		return joined
+	}
+	return path
+}
+
+// fileExists will identify if the path exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// hostUser returns the uid and gid of the user running the tests,
+// which are -1 on platforms without them.
+var hostUser = func() (int, int) {
+	return os.Getuid(), os.Getgid()
+}
+
+// galaxyCacheChown will give the files installed into the galaxy cache
+// by root in the container to the user running the tests, so they can
+// be removed from the host. Nothing is changed when the user is root.
+func (dist *Distribution) galaxyCacheChown() {
+
+	uid, gid := hostUser()
+	if uid <= 0 {
+		return
+	}
+
+	if _, err := DockerExec([]string{
+		"exec",
+		dist.CID,
+		"chown",
+		"-R",
+		fmt.Sprintf("%v:%v", uid, gid),
+		GalaxyCacheMount,
+	}, false); err != nil {
+		log.Warnf("could not change the owner of the galaxy cache: %v", err)
+	}
+}
+
+// PrepareGalaxyCache will assign a galaxy cache in root to the configuration,
+// keyed by the contents of the requirements file. Identical requirements will
+// share the same cache, so roles and collections are only downloaded once.
+// The cache is not created when commands are only planned.
+// This must be called before MapRequirements.
+func PrepareGalaxyCache(config *AnsibleConfig, root string) error {
+
+	if config.RequirementsFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(hostFilePath(config, config.RequirementsFile))
+	if err != nil {
+		return fmt.Errorf("could not read requirements file: %v", err)
+	}
+
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+	dir := filepath.Join(root, sum[:16])
+	config.GalaxyCache = dir
+
+	if planning() {
+		return nil
+	}
+
+	for _, path := range []string{"roles", "collections"} {
+		if err := os.MkdirAll(filepath.Join(dir, path), 0755); err != nil {
+			return err
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, galaxyCacheRequirements), data, 0644); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GalaxyCacheComplete will identify if the galaxy cache
+// of the configuration has been fully populated.
+func (config *AnsibleConfig) GalaxyCacheComplete() bool {
+	if config.GalaxyCache == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(config.GalaxyCache, galaxyCacheComplete))
+	return err == nil
+}
+
+// galaxyCacheHasCollections will identify if the cached
+// requirements file declares any collections.
+func galaxyCacheHasCollections(dir string) bool {
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, galaxyCacheRequirements))
+	if err != nil {
+		return false
+	}
+
+	requirements := struct {
+		Collections []interface{} `yaml:"collections"`
+	}{}
+	if err := yaml.Unmarshal(data, &requirements); err != nil {
+		// The legacy format is a list of roles.
+		return false
+	}
+
+	return len(requirements.Collections) > 0
+}
+
+// galaxyCacheInstall will populate the galaxy cache by installing the
+// cached requirements file into the mounted cache from inside the container.
+func (dist *Distribution) galaxyCacheInstall(config *AnsibleConfig) bool {
+
+	req := fmt.Sprintf("%v/%v", GalaxyCacheMount, galaxyCacheRequirements)
+	commands := [][]string{{
+		"ansible-galaxy",
+		"install",
+		"-r",
+		req,
+		"--roles-path",
+		GalaxyCacheMount + "/roles",
+	}}
+
+	if galaxyCacheHasCollections(config.GalaxyCache) {
+		commands = append(commands, []string{
+			"ansible-galaxy",
+			"collection",
+			"install",
+			"-r",
+			req,
+			"-p",
+			GalaxyCacheMount + "/collections",
+		})
+	}
+
+	for _, command := range commands {
+		args := append([]string{
+			"exec",
+			"--tty",
+			dist.CID,
+		}, command...)
+
+		// Add verbose if configured
+		if config.Verbose {
+			args = append(args, "-vvvv")
+		}
+
+		if _, err := DockerExec(args, !config.Quiet); err != nil {
+			log.Errorln(err)
+			dist.galaxyCacheChown()
+			return false
+		}
+	}
+	dist.galaxyCacheChown()
+
+	if planning() {
+		return true
+	}
+	if err := ioutil.WriteFile(filepath.Join(config.GalaxyCache, galaxyCacheComplete), []byte{}, 0644); err != nil {
+		log.Errorln(err)
+		return false
+	}
+
+	return true
+}
+
+// GalaxyCacheEnv will return the environment for the container which
+// makes the roles and collections in the galaxy cache available to Ansible.
+func GalaxyCacheEnv() []string {
+	return []string{
+		fmt.Sprintf("ANSIBLE_ROLES_PATH=/etc/ansible/roles:/root/.ansible/roles:%v/roles", GalaxyCacheMount),
+		fmt.Sprintf("ANSIBLE_COLLECTIONS_PATHS=%v/collections:/root/.ansible/collections:/usr/share/ansible/collections", GalaxyCacheMount),
+	}
+}
+
+// ExportGalaxyCache will write every galaxy cache in root
+// to a gzipped tarball, which can be imported elsewhere.
+func ExportGalaxyCache(root, filename string) (err error) {
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+
+	// The tarball is incomplete until every writer has been closed.
+	defer func() {
+		for _, closer := range []io.Closer{tw, gz, file} {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}()
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(root, path)
+		if name == "." {
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// ImportGalaxyCache will extract a tarball created by
+// ExportGalaxyCache into root, to populate the caches offline.
+// Entries are never written outside of root, either by their
+// path, by the target of a symlink or through an existing symlink.
+func ImportGalaxyCache(filename, root string) error {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	inside := func(path string) bool {
+		return strings.HasPrefix(path, resolved+string(os.PathSeparator))
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(root, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(root)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path %v in %v", header.Name, filename)
+		}
+
+		// The parent is resolved so symlinks extracted earlier
+		// cannot be used to write outside of root.
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if parent != resolved && !inside(parent) {
+			return fmt.Errorf("invalid path %v in %v: it is outside of %v", header.Name, filename, root)
+		}
+		path = filepath.Join(parent, filepath.Base(path))
+
+		// Existing symlinks are replaced rather than written through.
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, os.FileMode(header.Mode)|0700); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) || !inside(filepath.Join(parent, header.Linkname)) {
+				return fmt.Errorf("invalid symlink %v to %v in %v: it is outside of %v", header.Name, header.Linkname, filename, root)
+			}
+			os.Remove(path)
+			if err := os.Symlink(header.Linkname, path); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// galaxyCaches will return the galaxy caches in root, which are the
+// directories created by PrepareGalaxyCache. Anything else is ignored.
+func galaxyCaches(root string) ([]string, error) {
+
+	entries, err := ioutil.ReadDir(root)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return []string{}, err
+	}
+
+	caches := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !galaxyCacheRegexp.MatchString(entry.Name()) {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		if info, err := os.Lstat(filepath.Join(dir, galaxyCacheRequirements)); err == nil && info.Mode().IsRegular() {
+			caches = append(caches, dir)
+		}
+	}
+
+	return caches, nil
+}
+
+// GalaxyCacheList will return the galaxy caches in root with their size in bytes.
+func GalaxyCacheList(root string) (map[string]int64, error) {
+
+	caches := map[string]int64{}
+	dirs, err := galaxyCaches(root)
+	if err != nil {
+		return caches, err
+	}
+
+	for _, dir := range dirs {
+		var size int64
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				size += info.Size()
+			}
+			return nil
+		})
+		caches[dir] = size
+	}
+
+	return caches, nil
+}
+
+// GalaxyCacheClear will remove all galaxy caches in root, leaving
+// any other files and directories in root where they are.
+func GalaxyCacheClear(root string) error {
+
+	dirs, err := galaxyCaches(root)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
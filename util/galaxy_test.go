@@ -0,0 +1,226 @@
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// writeTarball will write a gzipped tarball of the headers to the file,
+// with the name of each regular file as its content.
+func writeTarball(t *testing.T, filename string, headers []tar.Header) {
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	for _, header := range headers {
+		header := header
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(header.Name))
+		}
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			tw.Write([]byte(header.Name))
+		}
+	}
+}
+
+func TestGalaxyCacheExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galaxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	role := filepath.Join(source, "0123456789abcdef", "roles", "example")
+	os.MkdirAll(role, 0755)
+	ioutil.WriteFile(filepath.Join(role, "main.yml"), []byte("---"), 0644)
+	os.Symlink("main.yml", filepath.Join(role, "link.yml"))
+
+	tarball := filepath.Join(dir, "cache.tar.gz")
+	if err := ExportGalaxyCache(source, tarball); err != nil {
+		t.Fatalf("ExportGalaxyCache() error = %v", err)
+	}
+
+	target := filepath.Join(dir, "target")
+	if err := ImportGalaxyCache(tarball, target); err != nil {
+		t.Fatalf("ImportGalaxyCache() error = %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(target, "0123456789abcdef", "roles", "example", "link.yml"))
+	if err != nil || string(data) != "---" {
+		t.Errorf("imported symlink = %q, %v", data, err)
+	}
+}
+
+func TestImportGalaxyCacheOutsideRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galaxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outside := filepath.Join(dir, "outside")
+	os.MkdirAll(outside, 0755)
+
+	tests := []struct {
+		name    string
+		headers []tar.Header
+	}{
+		{"parent path", []tar.Header{
+			{Name: "../outside/file", Typeflag: tar.TypeReg, Mode: 0644},
+		}},
+		{"absolute symlink", []tar.Header{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "link/file", Typeflag: tar.TypeReg, Mode: 0644},
+		}},
+		{"relative symlink", []tar.Header{
+			{Name: "cache/link", Typeflag: tar.TypeSymlink, Linkname: "../../../../outside"},
+			{Name: "cache/link/file", Typeflag: tar.TypeReg, Mode: 0644},
+		}},
+	}
+
+	for i, test := range tests {
+		root := filepath.Join(dir, "root", string(rune('a'+i)), "galaxy")
+		os.MkdirAll(filepath.Join(root, "cache"), 0755)
+		tarball := filepath.Join(dir, test.name+".tar.gz")
+		writeTarball(t, tarball, test.headers)
+		ImportGalaxyCache(tarball, root)
+
+		files, _ := ioutil.ReadDir(outside)
+		if len(files) > 0 {
+			t.Errorf("%v: %v was written outside of the root", test.name, files[0].Name())
+		}
+	}
+
+	// A symlink already in root is not written through.
+	root := filepath.Join(dir, "root", "existing")
+	os.MkdirAll(root, 0755)
+	os.Symlink(outside, filepath.Join(root, "cache"))
+	tarball := filepath.Join(dir, "existing.tar.gz")
+	writeTarball(t, tarball, []tar.Header{{Name: "cache/file", Typeflag: tar.TypeReg, Mode: 0644}})
+	if err := ImportGalaxyCache(tarball, root); err == nil {
+		t.Error("ImportGalaxyCache() wrote through an existing symlink")
+	}
+	if files, _ := ioutil.ReadDir(outside); len(files) > 0 {
+		t.Errorf("%v was written outside of the root", files[0].Name())
+	}
+}
+
+func TestGalaxyCacheClear(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galaxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := filepath.Join(dir, "0123456789abcdef")
+	os.MkdirAll(filepath.Join(cache, "roles"), 0755)
+	ioutil.WriteFile(filepath.Join(cache, galaxyCacheRequirements), []byte("---"), 0644)
+
+	// Directories which were not created by PrepareGalaxyCache are kept.
+	keep := []string{
+		filepath.Join(dir, "fedcba9876543210"),
+		filepath.Join(dir, "projects"),
+		filepath.Join(dir, "notes.txt"),
+	}
+	os.MkdirAll(keep[0], 0755)
+	os.MkdirAll(keep[1], 0755)
+	ioutil.WriteFile(filepath.Join(keep[1], galaxyCacheRequirements), []byte("---"), 0644)
+	ioutil.WriteFile(keep[2], []byte("notes"), 0644)
+
+	caches, err := GalaxyCacheList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := caches[cache]; !ok || len(caches) != 1 {
+		t.Errorf("GalaxyCacheList() = %v, want only %v", caches, cache)
+	}
+
+	if err := GalaxyCacheClear(dir); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(cache) {
+		t.Errorf("%v was not removed", cache)
+	}
+	for _, path := range keep {
+		if !fileExists(path) {
+			t.Errorf("%v was removed", path)
+		}
+	}
+}
+
+func TestGalaxyCacheInstallOwner(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "galaxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	user := hostUser
+	defer func() { hostUser = user }()
+
+	tests := []struct {
+		name  string
+		uid   int
+		fail  bool
+		chown string
+	}{
+		{"user", 1000, false, "1000:1001"},
+		{"failed install", 1000, true, "1000:1001"},
+		{"root", 0, false, ""},
+	}
+
+	for _, test := range tests {
+		fake := &FakeExecutor{
+			Respond: func(command Command) (CommandResult, error) {
+				if test.fail && contains(command.Args, "ansible-galaxy") {
+					return CommandResult{ExitCode: 1}, errors.New("exit status 1")
+				}
+				return CommandResult{}, nil
+			},
+		}
+		executor := CommandExecutor
+		CommandExecutor = fake
+		hostUser = func() (int, int) { return test.uid, test.uid + 1 }
+
+		dist := Ubuntu1804
+		dist.CID = "art-test"
+		config := AnsibleConfig{GalaxyCache: dir, Quiet: true}
+		installed := dist.galaxyCacheInstall(&config)
+		CommandExecutor = executor
+
+		if installed == test.fail {
+			t.Errorf("%v: got installed %v", test.name, installed)
+		}
+		chown := ""
+		for _, command := range fake.Commands {
+			if contains(command.Args, "chown") {
+				if want := []string{"exec", "art-test", "chown", "-R", test.chown, GalaxyCacheMount}; !reflect.DeepEqual(command.Args, want) {
+					t.Errorf("%v: got %v, want %v", test.name, command.Args, want)
+				}
+				chown = command.Args[4]
+			}
+		}
+		if chown != test.chown {
+			t.Errorf("%v: got owner %q, want %q", test.name, chown, test.chown)
+		}
+	}
+}
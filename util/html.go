@@ -0,0 +1,146 @@
+package util
+
+import (
+	"bytes"
+	"html/template"
+	"time"
+)
+
+// htmlStage is a stage of the report as it is shown in the HTML report.
+type htmlStage struct {
+	StageResult
+	Ran bool
+	Log string
+}
+
+// htmlData is the data the HTML report is rendered from.
+type htmlData struct {
+	Report        *AnsibleReport
+	Distributions []Distribution
+	Stages        []htmlStage
+	Logs          bool
+}
+
+// htmlTemplate is the HTML report. The page is self-contained
+// so it can be shared without any other files.
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) time.Duration {
+		return d.Round(time.Millisecond)
+	},
+	"timestamp": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Ansible Role Tester Report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292e; }
+h1 { font-size: 1.6em; } h2 { font-size: 1.2em; margin-top: 1.5em; border-bottom: 1px solid #e1e4e8; }
+table { border-collapse: collapse; } th, td { padding: 0.3em 0.8em; border: 1px solid #e1e4e8; text-align: left; }
+th { background: #f6f8fa; }
+.badge { display: inline-block; padding: 0.1em 0.6em; border-radius: 1em; color: #fff; font-size: 0.85em; }
+.passed { background: #28a745; } .failed { background: #d73a49; } .skipped { background: #6a737d; } .not-run { background: #d1d5da; color: #24292e; }
+details { margin: 0.5em 0; } summary { cursor: pointer; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; font-size: 0.85em; }
+</style>
+</head>
+<body>
+<h1>Ansible Role Tester Report</h1>
+{{- with .Report}}
+<table>
+<tr><th>Timestamp</th><td>{{timestamp .Meta.Timestamp}}</td></tr>
+{{- if .Meta.Repository}}
+<tr><th>Repository</th><td>{{.Meta.Repository}}</td></tr>
+<tr><th>Commit</th><td>{{.Meta.CommitHash}}</td></tr>
+<tr><th>Local changes</th><td>{{.Meta.LocalChanges}}</td></tr>
+{{- end}}
+<tr><th>Tool version</th><td>{{.Environment.ToolVersion}}</td></tr>
+<tr><th>Host OS</th><td>{{.Environment.HostOS}}</td></tr>
+{{- if .Environment.DockerVersion}}
+<tr><th>Docker version</th><td>{{.Environment.DockerVersion}}</td></tr>
+{{- end}}
+{{- if .Environment.AnsibleVersion}}
+<tr><th>Ansible version</th><td>{{.Environment.AnsibleVersion}}</td></tr>
+{{- end}}
+{{- if .Environment.PythonVersion}}
+<tr><th>Python version</th><td>{{.Environment.PythonVersion}}</td></tr>
+{{- end}}
+{{- if .Environment.ImageDigest}}
+<tr><th>Image digest</th><td>{{.Environment.ImageDigest}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+<h2>Distributions</h2>
+<table>
+<tr><th>Distribution</th><th>Image</th>{{range .Stages}}<th>{{.Name}}</th>{{end}}</tr>
+{{- $stages := .Stages}}
+{{- range .Distributions}}
+<tr><td>{{if .Name}}{{.Name}}{{else}}{{.CID}}{{end}}</td><td>{{.Container}}</td>
+{{- range $stages}}
+<td>{{if .Ran}}<span class="badge {{.Status}}">{{.Status}}</span>{{else}}<span class="badge not-run">not run</span>{{end}}</td>
+{{- end}}</tr>
+{{- end}}
+</table>
+
+<h2>Stages</h2>
+<table>
+<tr><th>Stage</th><th>Result</th><th>Start</th><th>Duration</th><th>Exit code</th></tr>
+{{- range .Stages}}{{if .Ran}}
+<tr><td>{{.Name}}</td><td><span class="badge {{.Status}}">{{.Status}}</span></td><td>{{timestamp .Start}}</td><td>{{duration .Duration}}</td><td>{{.ExitCode}}</td></tr>
+{{- end}}{{end}}
+</table>
+
+{{- with .Report.Ansible.Idempotence.Changed}}
+
+<h2>Non-idempotent tasks</h2>
+<ul>
+{{- range .}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+
+{{- if .Logs}}
+
+<h2>Logs</h2>
+{{- range .Stages}}{{if .Log}}
+<details{{if eq .Status "failed"}} open{{end}}>
+<summary>{{.Name}} <span class="badge {{.Status}}">{{.Status}}</span></summary>
+<pre>{{.Log}}</pre>
+</details>
+{{- end}}{{end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// GetHTML will return the report as a self-contained HTML page, including
+// the output of each stage when it was kept in the artifacts directory.
+func (report *AnsibleReport) GetHTML() ([]byte, error) {
+
+	data := htmlData{
+		Report:        report,
+		Distributions: report.Ansible.Instances,
+	}
+	if len(data.Distributions) == 0 {
+		data.Distributions = []Distribution{report.Ansible.Distribution}
+	}
+	for _, name := range ReportStages {
+		stage, ran := report.Stage(name)
+		data.Stages = append(data.Stages, htmlStage{
+			StageResult: stage,
+			Ran:         ran,
+			Log:         stripANSI(stage.ReadOutput()),
+		})
+		data.Logs = data.Logs || stage.Output != ""
+	}
+
+	var out bytes.Buffer
+	if err := htmlTemplate.Execute(&out, data); err != nil {
+		return []byte{}, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetHTML(t *testing.T) {
+	output, remove := writeStageOutput(t, "TASK [<script>alert(1)</script>]\n\x1b[0;31mfatal: [web]: FAILED!\x1b[0m\n")
+	defer remove()
+
+	report := AnsibleReport{}
+	report.Meta.Repository = "https://github.com/fubarhouse/ansible-role-example"
+	report.Meta.CommitHash = "0123abc"
+	report.Ansible.Distribution = Ubuntu1804
+	report.Ansible.Idempotence.Changed = []string{"example : Install packages (web)"}
+	report.Stages = []StageResult{
+		{Name: StageStart, Result: true},
+		{Name: StageRequirements, Result: true, Skipped: true},
+		{Name: StageConverge, Result: false, ExitCode: 2, Output: output},
+	}
+
+	data, err := report.GetHTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+
+	for _, want := range []string{
+		"<td>ubuntu1804</td><td>fubarhouse/docker-ansible:bionic</td>",
+		`<span class="badge passed">passed</span>`,
+		`<span class="badge skipped">skipped</span>`,
+		`<span class="badge failed">failed</span>`,
+		`<span class="badge not-run">not run</span>`,
+		"<td>0123abc</td>",
+		"<li>example : Install packages (web)</li>",
+		"<details open>\n<summary>converge",
+		"TASK [&lt;script&gt;alert(1)&lt;/script&gt;]",
+		"fatal: [web]: FAILED!\n",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML report does not contain %q", want)
+		}
+	}
+	for _, external := range []string{"<link", "<script", "src=", "\x1b"} {
+		if strings.Contains(html, external) {
+			t.Errorf("HTML report contains %q", external)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"errors"
+	"regexp"
 	"strconv"
 	"time"
 
@@ -12,8 +13,9 @@ import (
 )
 
 // IdempotenceTest will run an Ansible playbook once and check the
-// output for any changed or failed tasks as reported by Ansible.
-func (dist *Distribution) IdempotenceTest(config *AnsibleConfig) (bool, time.Duration) {
+// output for any changed or failed tasks as reported by Ansible,
+// returning the tasks which changed.
+func (dist *Distribution) IdempotenceTest(config *AnsibleConfig) (bool, time.Duration, []string) {
 
 	// Test role idempotence.
 	if !config.Quiet {
@@ -39,20 +41,23 @@ func (dist *Distribution) IdempotenceTest(config *AnsibleConfig) (bool, time.Dur
 	}
 
 	var idempotence = false
+	var changes []string
 	now := time.Now()
 	if !config.Quiet {
 		out, _ := DockerExec(args, true)
 		idempotence = IdempotenceResult(out)
+		changes = IdempotenceChanges(out)
 	} else {
 		out, _ := DockerExec(args, false)
 		idempotence = IdempotenceResult(out)
+		changes = IdempotenceChanges(out)
 	}
 
 	if !config.Quiet {
 		PrintIdempotenceResult(now, idempotence)
 	}
 
-	return idempotence, time.Since(now)
+	return idempotence, time.Since(now), changes
 
 }
 
@@ -72,7 +77,7 @@ func PrintIdempotenceResult(start time.Time, idempotence bool) {
 // simply need the values of changed and failed and some basic logic.
 func IdempotenceResult(output string) bool {
 
-	lines := strings.Split(output, "\n")
+	lines := strings.Split(stripANSI(output), "\n")
 
 	var changed int64
 	var failed int64
@@ -81,11 +86,16 @@ func IdempotenceResult(output string) bool {
 	for _, line := range lines {
 		if strings.Contains(line, "ok=") && strings.Contains(line, "changed=") {
 			f := strings.Split(line, "=")
+			// Every host has a line in the recap, so results are summed.
 			if strings.Contains(line, "changed=") {
-				changed, error = strconv.ParseInt(strings.Split(f[2], " ")[0], 0, 0)
+				var hostChanged int64
+				hostChanged, error = strconv.ParseInt(strings.Split(f[2], " ")[0], 0, 0)
+				changed += hostChanged
 			}
 			if strings.Contains(line, "failed=") {
-				failed, error = strconv.ParseInt(strings.Split(f[4], " ")[0], 0, 0)
+				var hostFailed int64
+				hostFailed, error = strconv.ParseInt(strings.Split(f[4], " ")[0], 0, 0)
+				failed += hostFailed
 			}
 		}
 	}
@@ -105,3 +115,54 @@ func IdempotenceResult(output string) bool {
 
 	return true
 }
+
+// IdempotenceChanges will return the tasks which changed in the output
+// of a playbook, in the form 'task name (host)', in the order they ran.
+func IdempotenceChanges(output string) []string {
+	return playbookTasks(output, "changed")
+}
+
+// PlaybookFailures will return the tasks which failed in the output
+// of a playbook, in the form 'task name (host)', in the order they ran.
+func PlaybookFailures(output string) []string {
+	return playbookTasks(output, "fatal", "failed")
+}
+
+// ansiRegexp matches the escape sequences Ansible colours output with.
+var ansiRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// stripANSI will remove the colours from the output of a command.
+func stripANSI(output string) string {
+	return ansiRegexp.ReplaceAllString(output, "")
+}
+
+// playbookTasks will return the tasks in the output of a playbook
+// with any of the statuses, in the form 'task name (host)'.
+func playbookTasks(output string, statuses ...string) []string {
+
+	tasks := []string{}
+	task := ""
+
+	for _, line := range strings.Split(stripANSI(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "TASK [") || strings.HasPrefix(line, "RUNNING HANDLER [") {
+			start := strings.Index(line, "[")
+			end := strings.LastIndex(line, "]")
+			if end > start {
+				task = line[start+1 : end]
+			}
+			continue
+		}
+		for _, status := range statuses {
+			if strings.HasPrefix(line, status+": [") {
+				host := strings.TrimPrefix(line, status+": [")
+				if end := strings.Index(host, "]"); end >= 0 {
+					host = host[:end]
+				}
+				tasks = append(tasks, fmt.Sprintf("%v (%v)", task, host))
+			}
+		}
+	}
+
+	return tasks
+}
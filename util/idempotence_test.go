@@ -0,0 +1,138 @@
+package util
+
+import (
+	"io/ioutil"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestIdempotenceResult(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	recap := "PLAY RECAP *********************************************************************\n"
+	tests := []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{
+			"no changes or failures",
+			recap + "localhost                  : ok=3    changed=0    unreachable=0    failed=0    skipped=1\n",
+			true,
+		},
+		{
+			"changes",
+			recap + "localhost                  : ok=3    changed=1    unreachable=0    failed=0\n",
+			false,
+		},
+		{
+			"failures",
+			recap + "localhost                  : ok=3    changed=0    unreachable=0    failed=2\n",
+			false,
+		},
+		{
+			"changes on one of several hosts",
+			recap + "web                        : ok=3    changed=0    unreachable=0    failed=0\n" +
+				"db                         : ok=3    changed=4    unreachable=0    failed=0\n",
+			false,
+		},
+		{
+			"coloured changes",
+			recap + "\x1b[0;33mlocalhost\x1b[0m                  : \x1b[0;32mok=3   \x1b[0m changed=\x1b[0;33m1   \x1b[0m unreachable=0    failed=0\n",
+			false,
+		},
+		{
+			"coloured without changes",
+			recap + "\x1b[0;32mlocalhost\x1b[0m                  : \x1b[0;32mok=3   \x1b[0m changed=0    unreachable=0    failed=0\n",
+			true,
+		},
+		{
+			"no recap",
+			"",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		if got := IdempotenceResult(test.output); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIdempotenceChanges(t *testing.T) {
+	output := `PLAY [all] *********************************************************************
+
+TASK [Gathering Facts] *********************************************************
+ok: [web]
+ok: [db]
+
+TASK [example : Install packages] **********************************************
+changed: [web] => (item=curl)
+ok: [db]
+
+TASK [example : Template configuration] ****************************************
+changed: [db]
+
+RUNNING HANDLER [example : restart service] ************************************
+changed: [db]
+
+PLAY RECAP *********************************************************************
+db                         : ok=4    changed=2    unreachable=0    failed=0
+web                        : ok=2    changed=1    unreachable=0    failed=0
+`
+	want := []string{
+		"example : Install packages (web)",
+		"example : Template configuration (db)",
+		"example : restart service (db)",
+	}
+
+	got := IdempotenceChanges(output)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("change %v: got %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if changes := IdempotenceChanges(""); len(changes) != 0 {
+		t.Errorf("got %v for empty output", changes)
+	}
+}
+
+func TestPlaybookFailures(t *testing.T) {
+	output := `TASK [example : Install packages] **********************************************
+ok: [web]
+fatal: [db]: FAILED! => {"changed": false, "msg": "No package matching 'curl' is available"}
+
+TASK [example : Start service] *************************************************
+failed: [web] (item=nginx) => {"changed": false, "msg": "Could not find the requested service nginx"}
+`
+	want := []string{
+		"example : Install packages (db)",
+		"example : Start service (web)",
+	}
+
+	got := PlaybookFailures(output)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("failure %v: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPlaybookFailuresColour(t *testing.T) {
+	output := "\x1b[0;32mTASK [example : Install packages] ****\x1b[0m\n" +
+		"\x1b[0;31mfatal: [db]: FAILED! => {\"changed\": false}\x1b[0m\n"
+
+	got := PlaybookFailures(output)
+	if want := "example : Install packages (db)"; len(got) != 1 || got[0] != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,167 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry assumed for references without one.
+	DefaultRegistry = "docker.io"
+
+	// DefaultNamespace is the namespace assumed for official images
+	// on the default registry, such as 'ubuntu' or 'centos'.
+	DefaultNamespace = "library"
+
+	// DefaultTag is the tag assumed for references without a tag or digest.
+	DefaultTag = "latest"
+)
+
+var (
+	// imageComponentRegexp matches a single path component of a repository.
+	imageComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+
+	// imageRegistryRegexp matches a registry host with an optional port.
+	imageRegistryRegexp = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9.-]*[a-zA-Z0-9])?(?::[0-9]+)?$`)
+
+	// imageTagRegexp matches a tag.
+	imageTagRegexp = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+	// imageDigestRegexp matches a content addressable digest.
+	imageDigestRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+)
+
+// ImageReference is a parsed Docker image reference in the format
+// [registry/][namespace/]repository[:tag][@digest], for example
+// registry.local:5000/team/img:tag or ubuntu@sha256:...
+type ImageReference struct {
+
+	// Registry is the registry host, including the port if any.
+	// It is empty when the reference did not specify a registry.
+	Registry string
+
+	// Namespace is the path between the registry and the repository,
+	// which is commonly the user or organisation owning the image.
+	Namespace string
+
+	// Repository is the final path component of the image name.
+	Repository string
+
+	// Tag is the tag of the image, if specified.
+	Tag string
+
+	// Digest is the content addressable digest of the image, if specified.
+	Digest string
+}
+
+// ParseImageReference will parse the input into an ImageReference,
+// returning an error describing the problem if the reference is invalid.
+func ParseImageReference(image string) (ImageReference, error) {
+
+	ref := ImageReference{}
+	name := strings.TrimSpace(image)
+
+	if name == "" {
+		return ref, errors.New("image reference is empty")
+	}
+
+	// The digest is always the trailing component.
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !imageDigestRegexp.MatchString(ref.Digest) {
+			return ref, fmt.Errorf("invalid digest '%v' in image reference '%v'", ref.Digest, image)
+		}
+	}
+
+	// The tag is separated by a colon in the last path component,
+	// which distinguishes it from the port of a registry.
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+		if !imageTagRegexp.MatchString(ref.Tag) {
+			return ref, fmt.Errorf("invalid tag '%v' in image reference '%v'", ref.Tag, image)
+		}
+	}
+
+	components := strings.Split(name, "/")
+
+	// The first component is a registry if it looks like a host name.
+	if len(components) > 1 {
+		first := components[0]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			if !imageRegistryRegexp.MatchString(first) {
+				return ref, fmt.Errorf("invalid registry '%v' in image reference '%v'", first, image)
+			}
+			ref.Registry = first
+			components = components[1:]
+		}
+	}
+
+	for _, component := range components {
+		if !imageComponentRegexp.MatchString(component) {
+			return ref, fmt.Errorf("invalid repository name '%v' in image reference '%v'", name, image)
+		}
+	}
+
+	ref.Repository = components[len(components)-1]
+	ref.Namespace = strings.Join(components[:len(components)-1], "/")
+
+	return ref, nil
+}
+
+// Name will return the reference without the tag or digest.
+func (ref ImageReference) Name() string {
+	parts := []string{}
+	for _, part := range []string{ref.Registry, ref.Namespace, ref.Repository} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// String will return the reference in the same form it was parsed.
+func (ref ImageReference) String() string {
+	name := ref.Name()
+	if ref.Tag != "" {
+		name = fmt.Sprintf("%v:%v", name, ref.Tag)
+	}
+	if ref.Digest != "" {
+		name = fmt.Sprintf("%v@%v", name, ref.Digest)
+	}
+	return name
+}
+
+// Normalized will return the fully qualified form of the reference,
+// with the default registry, namespace and tag applied where absent.
+// Two references to the same image will have the same normalized form.
+func (ref ImageReference) Normalized() string {
+	normal := ref
+	if normal.Registry == "" || normal.Registry == "index.docker.io" {
+		normal.Registry = DefaultRegistry
+	}
+	if normal.Namespace == "" && normal.Registry == DefaultRegistry {
+		normal.Namespace = DefaultNamespace
+	}
+	if normal.Tag == "" && normal.Digest == "" {
+		normal.Tag = DefaultTag
+	}
+	return normal.String()
+}
+
+// SameImage will identify if two image references refer to the same image.
+// Invalid references are never considered to be the same image.
+func SameImage(a, b string) bool {
+	refA, err := ParseImageReference(a)
+	if err != nil {
+		return false
+	}
+	refB, err := ParseImageReference(b)
+	if err != nil {
+		return false
+	}
+	return refA.Normalized() == refB.Normalized()
+}
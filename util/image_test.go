@@ -0,0 +1,182 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		image   string
+		want    ImageReference
+		wantErr bool
+	}{
+		{"ubuntu", ImageReference{Repository: "ubuntu"}, false},
+		{"ubuntu:22.04", ImageReference{Repository: "ubuntu", Tag: "22.04"}, false},
+		{"fubarhouse/docker-ansible:bionic", ImageReference{Namespace: "fubarhouse", Repository: "docker-ansible", Tag: "bionic"}, false},
+		{"registry:5000/ns/img:tag", ImageReference{Registry: "registry:5000", Namespace: "ns", Repository: "img", Tag: "tag"}, false},
+		{"registry.local:5000/team/nested/img", ImageReference{Registry: "registry.local:5000", Namespace: "team/nested", Repository: "img"}, false},
+		{"localhost/img:1", ImageReference{Registry: "localhost", Repository: "img", Tag: "1"}, false},
+		{
+			"img@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			ImageReference{Repository: "img", Digest: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+			false,
+		},
+		{
+			"centos:7@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			ImageReference{Repository: "centos", Tag: "7", Digest: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+			false,
+		},
+		{"", ImageReference{}, true},
+		{"Ubuntu", ImageReference{}, true},
+		{"ubuntu:", ImageReference{}, true},
+		{"ubuntu:bad tag", ImageReference{}, true},
+		{"img@sha256:short", ImageReference{}, true},
+		{"bad_host.:5000/img", ImageReference{}, true},
+		{"ns//img", ImageReference{}, true},
+	}
+
+	for _, test := range tests {
+		ref, err := ParseImageReference(test.image)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseImageReference(%q): got error %v, want error %v", test.image, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		if ref != test.want {
+			t.Errorf("ParseImageReference(%q) = %+v, want %+v", test.image, ref, test.want)
+		}
+		if ref.String() != test.image {
+			t.Errorf("ParseImageReference(%q).String() = %q", test.image, ref.String())
+		}
+	}
+}
+
+func TestImageReferenceNormalized(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"ubuntu", "docker.io/library/ubuntu:latest"},
+		{"ubuntu:22.04", "docker.io/library/ubuntu:22.04"},
+		{"index.docker.io/fubarhouse/docker-ansible:bionic", "docker.io/fubarhouse/docker-ansible:bionic"},
+		{"registry:5000/ns/img:tag", "registry:5000/ns/img:tag"},
+		{"registry:5000/img", "registry:5000/img:latest"},
+		{
+			"img@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			"docker.io/library/img@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		},
+	}
+
+	for _, test := range tests {
+		ref, err := ParseImageReference(test.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ref.Normalized(); got != test.want {
+			t.Errorf("%q normalized to %q, want %q", test.image, got, test.want)
+		}
+	}
+}
+
+func TestSameImage(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"ubuntu", "docker.io/library/ubuntu:latest", true},
+		{"ubuntu:22.04", "library/ubuntu:22.04", true},
+		{"ubuntu:22.04", "ubuntu:20.04", false},
+		{"registry:5000/ns/img:tag", "registry:5000/ns/img:tag", true},
+		{"registry:5000/ns/img:tag", "ns/img:tag", false},
+		{"Not An Image", "Not An Image", false},
+	}
+
+	for _, test := range tests {
+		if got := SameImage(test.a, test.b); got != test.want {
+			t.Errorf("SameImage(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestDistributionsCatalogue(t *testing.T) {
+	names := map[string]bool{}
+	for _, dist := range Distributions {
+		if _, err := ParseImageReference(dist.Container); err != nil {
+			t.Errorf("%v has an invalid image: %v", dist.Name, err)
+		}
+		if dist.Name == "" || dist.User == "" || dist.Distro == "" {
+			t.Errorf("%v is missing a name, user or distro", dist.Container)
+		}
+		key := dist.User + "/" + dist.Distro
+		if names[key] {
+			t.Errorf("%v is declared more than once", key)
+		}
+		names[key] = true
+	}
+}
+
+func TestDockerPullDigest(t *testing.T) {
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	fake := &FakeExecutor{}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	dist := Ubuntu1804
+	dist.Digest = digest
+	if err := dist.DockerPull(PullAlways, true); err != nil {
+		t.Fatalf("DockerPull() error = %v", err)
+	}
+
+	want := "fubarhouse/docker-ansible:bionic@" + digest
+	if dist.Container != want {
+		t.Errorf("Container = %v, want %v", dist.Container, want)
+	}
+	if len(fake.Commands) == 0 {
+		t.Fatal("no commands were run")
+	}
+	args := fake.Commands[len(fake.Commands)-1].Args
+	if args[len(args)-1] != want {
+		t.Errorf("pulled %v, want %v", args[len(args)-1], want)
+	}
+}
+
+func TestDockerPullBaseMirror(t *testing.T) {
+	fake := &FakeExecutor{}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	if err := dockerPullBase("centos:7", PullAlways, "registry.local:5000", true); err != nil {
+		t.Fatalf("dockerPullBase() error = %v", err)
+	}
+
+	commands := []string{}
+	for _, command := range fake.Commands {
+		commands = append(commands, strings.Join(command.Args, " "))
+	}
+	want := []string{
+		"pull registry.local:5000/library/centos:7",
+		"tag registry.local:5000/library/centos:7 centos:7",
+	}
+	if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", commands, want)
+	}
+}
+
+func TestUseMirrorSidecars(t *testing.T) {
+	sidecars := []Sidecar{{Name: "mysql", Image: "mysql:5.7"}, {Name: "cache", Image: "registry.local:5000/redis"}}
+	if err := UseMirrorSidecars(sidecars, "registry.local:5000"); err != nil {
+		t.Fatal(err)
+	}
+	if sidecars[0].Image != "registry.local:5000/library/mysql:5.7" {
+		t.Errorf("sidecar image = %v", sidecars[0].Image)
+	}
+	if sidecars[1].Image != "registry.local:5000/redis" {
+		t.Errorf("sidecar image = %v", sidecars[1].Image)
+	}
+}
@@ -6,8 +6,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-
-	log "github.com/sirupsen/logrus"
 )
 
 // GenericFileAssignment will take a path and parse check it for specific
@@ -71,8 +69,8 @@ func GenericPlaybookAssignment(input, path string) (string, error) {
 // MapPlaybook will adjust the playbook path for the appropriate
 // path based on the configuration. ie remote or not, and
 // guesswork based upon input. For example, paths starting with
-// /, ./ or otherwise.
-func MapPlaybook(config *AnsibleConfig) {
+// /, ./ or otherwise. An error is returned if the playbook does not exist.
+func MapPlaybook(config *AnsibleConfig) error {
 
 	playbook, err := GenericFileAssignment(config.PlaybookFile, config.HostPath, true)
 	if err != nil {
@@ -81,7 +79,7 @@ func MapPlaybook(config *AnsibleConfig) {
 	config.PlaybookFile = playbook
 
 	if err != nil {
-		log.Fatalf("Specified playbook file %v does not exist.", config.PlaybookFile)
+		return fmt.Errorf("specified playbook file %v does not exist", config.PlaybookFile)
 	}
 
 	if !config.Remote && config.PlaybookFile != "" {
@@ -89,28 +87,27 @@ func MapPlaybook(config *AnsibleConfig) {
 		config.PlaybookFile = strings.Replace(config.PlaybookFile, pwd, config.RemotePath, -1)
 	}
 
-	if err == nil {
-		if config.Remote && config.RemotePath == "" {
-			pwd, _ := os.Getwd()
-			config.RemotePath = pwd
-		} else if !config.Remote && config.RemotePath == "" {
-			config.RemotePath = "/etc/ansible/roles/role_under_test"
-		}
+	if config.Remote && config.RemotePath == "" {
+		pwd, _ := os.Getwd()
+		config.RemotePath = pwd
+	} else if !config.Remote && config.RemotePath == "" {
+		config.RemotePath = "/etc/ansible/roles/role_under_test"
 	}
 
+	return nil
 }
 
 // MapInventory will adjust the inventory path for the appropriate
 // path based on the configuration. ie remote or not, and
 // guesswork based upon input. For example, paths starting with
-// /, ./ or otherwise.
-func MapInventory(CID string, config *AnsibleConfig) {
+// /, ./ or otherwise. An error is returned if the inventory does not exist.
+func MapInventory(CID string, config *AnsibleConfig) error {
 
 	inventory, err := GenericFileAssignment(config.Inventory, config.HostPath, false)
 	config.Inventory = inventory
 
 	if err != nil {
-		log.Fatalf("Specified inventory file %v does not exist.", config.Inventory)
+		return fmt.Errorf("specified inventory file %v does not exist", config.Inventory)
 	}
 
 	if !config.Remote && config.Inventory != "" {
@@ -119,19 +116,21 @@ func MapInventory(CID string, config *AnsibleConfig) {
 		config.Inventory = fmt.Sprintf("%v/%v", config.RemotePath, config.Inventory)
 	}
 
+	return nil
 }
 
 // MapRequirements will adjust the requirements path for the appropriate
 // path based on the configuration. ie remote or not, and
 // guesswork based upon input. For example, paths starting with
-// /, ./ or otherwise.
-func MapRequirements(config *AnsibleConfig) {
+// /, ./ or otherwise. An error is returned if the requirements file
+// does not exist.
+func MapRequirements(config *AnsibleConfig) error {
 
 	requirements, err := GenericFileAssignment(config.RequirementsFile, config.HostPath, true)
 	config.RequirementsFile = requirements
 
 	if err != nil {
-		log.Fatalf("Specified requirements file %v does not exist.", config.RequirementsFile)
+		return fmt.Errorf("specified requirements file %v does not exist", config.RequirementsFile)
 	}
 
 	if !config.Remote && config.RequirementsFile != "" {
@@ -140,4 +139,5 @@ func MapRequirements(config *AnsibleConfig) {
 		config.RequirementsFile = fmt.Sprintf("%v/%v", config.RemotePath, config.RequirementsFile)
 	}
 
+	return nil
 }
@@ -0,0 +1,123 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// roleDir will create a role containing tests/playbook.yml and change
+// the working directory to it, returning a function to restore it.
+func roleDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "ansible-role-tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "tests"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "tests", "playbook.yml"), []byte("---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pwd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, func() {
+		os.Chdir(pwd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMapPlaybook(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir, cleanup := roleDir(t)
+	defer cleanup()
+
+	tests := []struct {
+		name       string
+		playbook   string
+		remote     bool
+		remotePath string
+		want       string
+		wantRemote string
+	}{
+		{"relative", "tests/playbook.yml", false, "/etc/ansible/roles/role_under_test", "tests/playbook.yml", "/etc/ansible/roles/role_under_test"},
+		{"absolute", filepath.Join(dir, "tests", "playbook.yml"), false, "/etc/ansible/roles/role_under_test", "/etc/ansible/roles/role_under_test/tests/playbook.yml", "/etc/ansible/roles/role_under_test"},
+		{"missing", "playbook.yml", false, "/etc/ansible/roles/role_under_test", "tests/playbook.yml", "/etc/ansible/roles/role_under_test"},
+		{"default remote path", "tests/playbook.yml", false, "", "tests/playbook.yml", "/etc/ansible/roles/role_under_test"},
+		{"default remote path for remote runs", "tests/playbook.yml", true, "", "tests/playbook.yml", dir},
+	}
+
+	for _, test := range tests {
+		config := AnsibleConfig{
+			HostPath:     dir,
+			PlaybookFile: test.playbook,
+			Remote:       test.remote,
+			RemotePath:   test.remotePath,
+		}
+		if err := MapPlaybook(&config); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+		if config.PlaybookFile != test.want {
+			t.Errorf("%v: got playbook %v, want %v", test.name, config.PlaybookFile, test.want)
+		}
+		if config.RemotePath != test.wantRemote {
+			t.Errorf("%v: got remote path %v, want %v", test.name, config.RemotePath, test.wantRemote)
+		}
+	}
+}
+
+func TestMapInventory(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir, cleanup := roleDir(t)
+	defer cleanup()
+
+	tests := []struct {
+		name      string
+		inventory string
+		remote    bool
+		want      string
+	}{
+		{"none", "", false, ""},
+		{"relative", "tests/inventory", false, "/etc/ansible/roles/role_under_test/tests/inventory"},
+		{"remote", "tests/inventory", true, "tests/inventory"},
+	}
+
+	for _, test := range tests {
+		config := AnsibleConfig{
+			HostPath:   dir,
+			Inventory:  test.inventory,
+			Remote:     test.remote,
+			RemotePath: "/etc/ansible/roles/role_under_test",
+		}
+		if err := MapInventory("art-test", &config); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+		if config.Inventory != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, config.Inventory, test.want)
+		}
+	}
+}
+
+func TestMapRequirements(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir, cleanup := roleDir(t)
+	defer cleanup()
+
+	config := AnsibleConfig{
+		HostPath:         dir,
+		RequirementsFile: filepath.Join(dir, "tests", "missing.yml"),
+		RemotePath:       "/etc/ansible/roles/role_under_test",
+	}
+	if err := MapRequirements(&config); err == nil {
+		t.Error("a missing requirements file was mapped")
+	}
+}
@@ -0,0 +1,126 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// markdownStatus is the symbol of each stage status in the Markdown summary.
+var markdownStatus = map[string]string{
+	"passed":  "✅",
+	"failed":  "❌",
+	"skipped": "⏭️",
+}
+
+// markdownResult will return the status of the report, in the same way
+// as the exit code of a test: it failed if a stage failed or no stage was
+// recorded, as the container did not start, and it was skipped if every
+// stage testing the role was skipped.
+func (report *AnsibleReport) markdownResult() string {
+
+	if len(report.Stages) == 0 {
+		return "failed"
+	}
+
+	result := "skipped"
+	for _, stage := range report.Stages {
+		switch {
+		case stage.Status() == "failed":
+			return "failed"
+		case stage.Status() == "passed" && stage.Name != StageStart && stage.Name != StageDestroy:
+			result = "passed"
+		}
+	}
+	return result
+}
+
+// GetMarkdown will return a compact summary of the report in Markdown,
+// suitable for a pull request comment or $GITHUB_STEP_SUMMARY. Failing
+// tasks are read from the output of failed stages when it was kept.
+func (report *AnsibleReport) GetMarkdown() []byte {
+
+	var out bytes.Buffer
+
+	result := report.markdownResult()
+	fmt.Fprintf(&out, "### %v Ansible Role Tester: %v\n\n", markdownStatus[result], result)
+
+	if report.Meta.CommitHash != "" {
+		changes := ""
+		if report.Meta.LocalChanges {
+			changes = " with local changes"
+		}
+		fmt.Fprintf(&out, "Commit `%v`%v, ", shortHash(report.Meta.CommitHash), changes)
+	}
+	fmt.Fprintf(&out, "Ansible %v on Docker %v.\n\n", markdownVersion(report.Environment.AnsibleVersion), markdownVersion(report.Environment.DockerVersion))
+
+	// The matrix has a row for each distribution and a column for each stage.
+	distributions := report.Ansible.Instances
+	if len(distributions) == 0 {
+		distributions = []Distribution{report.Ansible.Distribution}
+	}
+	fmt.Fprintf(&out, "| Distribution | %v | Duration |\n", strings.Join(ReportStages, " | "))
+	fmt.Fprintf(&out, "|---%v|---:|\n", strings.Repeat("|:---:", len(ReportStages)))
+
+	cells := []string{}
+	var total time.Duration
+	for _, name := range ReportStages {
+		stage, ran := report.Stage(name)
+		if !ran {
+			cells = append(cells, "—")
+			continue
+		}
+		total += stage.Duration
+		cell := markdownStatus[stage.Status()]
+		if !stage.Skipped {
+			cell += " " + stage.Duration.Round(time.Second/10).String()
+		}
+		cells = append(cells, cell)
+	}
+	for _, dist := range distributions {
+		name := dist.Name
+		if name == "" {
+			name = dist.CID
+		}
+		fmt.Fprintf(&out, "| %v | %v | %v |\n", name, strings.Join(cells, " | "), total.Round(time.Second/10))
+	}
+
+	failures := []string{}
+	for _, stage := range report.Stages {
+		if stage.Status() != "failed" {
+			continue
+		}
+		tasks := PlaybookFailures(stage.FailureOutput())
+		if len(tasks) == 0 {
+			failures = append(failures, fmt.Sprintf("- **%v** failed with exit code %v", stage.Name, stage.ExitCode))
+		}
+		for _, task := range tasks {
+			failures = append(failures, fmt.Sprintf("- **%v**: `%v`", stage.Name, task))
+		}
+	}
+	for _, task := range report.Ansible.Idempotence.Changed {
+		failures = append(failures, fmt.Sprintf("- **%v** changed: `%v`", StageIdempotence, task))
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(&out, "\n#### Failing tasks\n\n%v\n", strings.Join(failures, "\n"))
+	}
+
+	return out.Bytes()
+}
+
+// shortHash will return the abbreviated form of a commit hash.
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+// markdownVersion will return the version, or unknown when it is empty.
+func markdownVersion(version string) string {
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
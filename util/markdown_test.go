@@ -0,0 +1,75 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetMarkdownResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []StageResult
+		want   string
+	}{
+		{"no stages", nil, "### ❌ Ansible Role Tester: failed\n"},
+		{"only the container", []StageResult{
+			{Name: StageStart, Result: true},
+			{Name: StageSyntax, Skipped: true},
+			{Name: StageConverge, Skipped: true},
+			{Name: StageDestroy, Result: true},
+		}, "### ⏭️ Ansible Role Tester: skipped\n"},
+		{"passed", []StageResult{
+			{Name: StageStart, Result: true},
+			{Name: StageSyntax, Skipped: true},
+			{Name: StageConverge, Result: true},
+			{Name: StageDestroy, Result: true},
+		}, "### ✅ Ansible Role Tester: passed\n"},
+		{"failed", []StageResult{
+			{Name: StageStart, Result: true},
+			{Name: StageConverge, Result: true},
+			{Name: StageDestroy},
+		}, "### ❌ Ansible Role Tester: failed\n"},
+	}
+
+	for _, test := range tests {
+		report := AnsibleReport{Stages: test.stages}
+		if markdown := string(report.GetMarkdown()); !strings.HasPrefix(markdown, test.want) {
+			t.Errorf("%v: got %q, want %q", test.name, strings.SplitN(markdown, "\n", 2)[0], test.want)
+		}
+	}
+}
+
+func TestGetMarkdown(t *testing.T) {
+	output, remove := writeStageOutput(t, "TASK [example : Install packages] ***\nfatal: [art-test]: FAILED! => {}\n")
+	defer remove()
+
+	report := AnsibleReport{}
+	report.Meta.CommitHash = "0123456789abcdef"
+	report.Environment.AnsibleVersion = "2.9.6"
+	report.Ansible.Distribution = Ubuntu1804
+	report.Stages = []StageResult{
+		{Name: StageStart, Result: true, Duration: 2 * time.Second},
+		{Name: StageRequirements, Result: true, Skipped: true},
+		{Name: StageConverge, ExitCode: 2, Duration: 1500 * time.Millisecond, Output: output},
+		{Name: StageDestroy, Result: true, Duration: time.Second},
+	}
+
+	markdown := string(report.GetMarkdown())
+	for _, want := range []string{
+		"### ❌ Ansible Role Tester: failed\n",
+		"Commit `0123456`, Ansible 2.9.6 on Docker unknown.",
+		"| Distribution | start | requirements | prepare | syntax | converge | idempotence | destroy | Duration |",
+		"| ubuntu1804 | ✅ 2s | ⏭️ | — | — | ❌ 1.5s | — | ✅ 1s | 4.5s |",
+		"- **converge**: `example : Install packages (art-test)`",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Markdown summary does not contain %q:\n%v", want, markdown)
+		}
+	}
+
+	report.Stages[2].Output = ""
+	if markdown := string(report.GetMarkdown()); !strings.Contains(markdown, "- **converge** failed with exit code 2") {
+		t.Errorf("Markdown summary does not contain the exit code of the failed stage:\n%v", markdown)
+	}
+}
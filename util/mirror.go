@@ -0,0 +1,137 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MirrorEnv is the environment variable containing the registry
+// which images should be pulled from instead of their origin.
+const MirrorEnv = "ANSIBLE_ROLE_TESTER_MIRROR"
+
+// MirrorImage will return the reference of the image in the specified
+// mirror registry. The registry of the original image is replaced, and
+// the namespace is retained so images from different users do not clash,
+// ie fubarhouse/docker-ansible:bionic becomes
+// registry.local:5000/fubarhouse/docker-ansible:bionic
+func MirrorImage(image, registry string) (string, error) {
+
+	registry = strings.TrimSuffix(registry, "/")
+	if !imageRegistryRegexp.MatchString(registry) {
+		return "", fmt.Errorf("invalid mirror registry '%v'", registry)
+	}
+
+	ref, err := ParseImageReference(image)
+	if err != nil {
+		return "", err
+	}
+
+	if ref.Registry == registry {
+		return ref.String(), nil
+	}
+
+	if ref.Namespace == "" && (ref.Registry == "" || ref.Registry == DefaultRegistry) {
+		ref.Namespace = DefaultNamespace
+	}
+	ref.Registry = registry
+
+	return ref.String(), nil
+}
+
+// UseMirror will rewrite the image of the Distribution to the
+// specified mirror registry, see MirrorImage.
+func (dist *Distribution) UseMirror(registry string) error {
+
+	image, err := MirrorImage(dist.Container, registry)
+	if err != nil {
+		return err
+	}
+
+	dist.Container = image
+	return nil
+}
+
+// UseMirrorSidecars will rewrite the images of the sidecars to the
+// specified mirror registry, see MirrorImage.
+func UseMirrorSidecars(sidecars []Sidecar, registry string) error {
+
+	for i := range sidecars {
+		image, err := MirrorImage(sidecars[i].Image, registry)
+		if err != nil {
+			return fmt.Errorf("sidecar %v: %v", sidecars[i].Name, err)
+		}
+		sidecars[i].Image = image
+	}
+
+	return nil
+}
+
+// DockerMirrorImage will copy the image into the mirror registry by
+// pulling it from its origin, tagging it and pushing it to the mirror.
+// The reference of the image in the mirror is returned.
+func DockerMirrorImage(image, registry string, quiet bool) (string, error) {
+
+	target, err := MirrorImage(image, registry)
+	if err != nil {
+		return "", err
+	}
+
+	if err := DockerPullImage(image, quiet); err != nil {
+		return target, err
+	}
+
+	// Images cannot be tagged by digest, so the tag is used instead.
+	ref, _ := ParseImageReference(target)
+	ref.Digest = ""
+	if ref.Tag == "" {
+		ref.Tag = DefaultTag
+	}
+	tagged := ref.String()
+
+	if _, err := DockerExec([]string{
+		"tag",
+		image,
+		tagged,
+	}, false); err != nil {
+		return target, fmt.Errorf("could not tag %v as %v: %v", image, tagged, err)
+	}
+
+	if !quiet {
+		log.Printf("Pushing %v", tagged)
+	}
+
+	args, _, cleanup, err := dockerRegistryArgs("push", tagged, quiet)
+	defer cleanup()
+	if err != nil {
+		return target, err
+	}
+
+	if _, stderr, err := DockerExecOutput(args, !quiet); err != nil {
+		if isAuthFailure(stderr) {
+			return target, &RegistryAuthError{
+				Registry: registry,
+				Image:    tagged,
+				Output:   stderr,
+			}
+		}
+		return target, fmt.Errorf("could not push %v: %v", tagged, err)
+	}
+
+	return target, nil
+}
+
+// DockerMirrorAll will copy every specified image into the mirror
+// registry with at most parallel copies running at once. Results
+// contain the reference of each image in the mirror.
+func DockerMirrorAll(images []string, registry string, parallel int) []PullResult {
+	return parallelImages(images, parallel, func(image string) PullResult {
+		result := PullResult{}
+		result.Image, result.Error = DockerMirrorImage(image, registry, true)
+		if result.Error == nil {
+			result.Digest, result.Error = ImageDigest(result.Image)
+		}
+		return result
+	})
+}
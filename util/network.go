@@ -0,0 +1,139 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// NetworkNone will start the container without any networking.
+	NetworkNone = "none"
+
+	// NetworkInternal will start the container on an internal network
+	// without external connectivity, shared only with its sidecars.
+	NetworkInternal = "internal"
+)
+
+// ValidNetworkMode will return an error if the input is not a known
+// network mode. An empty network mode uses the Docker default network.
+func ValidNetworkMode(mode string) error {
+	switch mode {
+	case "", NetworkNone, NetworkInternal:
+		return nil
+	}
+	return fmt.Errorf("invalid network mode '%v', expected %v or %v", mode, NetworkNone, NetworkInternal)
+}
+
+// NetworkPrepare will configure the network of the container according
+// to the NetworkMode of the configuration, creating an internal network
+// labelled as belonging to the container if required.
+func (dist *Distribution) NetworkPrepare(config *AnsibleConfig) error {
+
+	if err := ValidNetworkMode(config.NetworkMode); err != nil {
+		return err
+	}
+
+	if dist.CID == "" {
+		dist.CID = fmt.Sprint(time.Now().Unix())
+	}
+
+	switch config.NetworkMode {
+	case NetworkNone:
+		if config.Network != "" && config.Network != NetworkNone {
+			return errors.New("network mode none cannot be used with a network")
+		}
+		config.Network = NetworkNone
+	case NetworkInternal:
+		if config.Network == "" {
+			config.Network = fmt.Sprintf("%v-network", dist.CID)
+		}
+		if err := DockerNetworkCreate(config.Network, true, []string{fmt.Sprintf("%v=%v", ParentLabel, dist.CID)}, config.Quiet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NetworkName will return the name of the network mode for reporting.
+func (config *AnsibleConfig) NetworkName() string {
+	if config.NetworkMode != "" {
+		return config.NetworkMode
+	}
+	return "default"
+}
+
+// DockerNetworkExists will identify if the specified network exists.
+func DockerNetworkExists(name string) bool {
+
+	out, err := DockerExec([]string{
+		"network",
+		"ls",
+		"--quiet",
+		"--filter",
+		fmt.Sprintf("name=^%v$", name),
+	}, false)
+
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(out) != ""
+}
+
+// DockerNetworkCreate will create the specified network with the labels
+// (in the form key=value) if it does not already exist. Internal networks
+// have no external connectivity, containers can only reach each other.
+func DockerNetworkCreate(name string, internal bool, labels []string, quiet bool) error {
+
+	if DockerNetworkExists(name) {
+		return nil
+	}
+
+	if !quiet {
+		log.Printf("Creating network %v", name)
+	}
+
+	args := []string{
+		"network",
+		"create",
+	}
+	if internal {
+		args = append(args, "--internal")
+	}
+	for _, label := range labels {
+		args = append(args, fmt.Sprintf("--label=%v", label))
+	}
+
+	if _, err := DockerExec(append(args, name), false); err != nil {
+		return fmt.Errorf("could not create network %v: %v", name, err)
+	}
+
+	return nil
+}
+
+// DockerNetworkRemove will remove the specified network if it exists.
+func DockerNetworkRemove(name string, quiet bool) error {
+
+	if !DockerNetworkExists(name) {
+		return nil
+	}
+
+	if !quiet {
+		log.Printf("Removing network %v", name)
+	}
+
+	if _, err := DockerExec([]string{
+		"network",
+		"rm",
+		name,
+	}, false); err != nil {
+		return fmt.Errorf("could not remove network %v: %v", name, err)
+	}
+
+	return nil
+}
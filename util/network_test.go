@@ -0,0 +1,161 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestValidNetworkMode(t *testing.T) {
+	for _, mode := range []string{"", NetworkNone, NetworkInternal} {
+		if err := ValidNetworkMode(mode); err != nil {
+			t.Errorf("%q: %v", mode, err)
+		}
+	}
+	for _, mode := range []string{"host", "bridge", "Internal"} {
+		if err := ValidNetworkMode(mode); err == nil {
+			t.Errorf("%q: an invalid network mode was accepted", mode)
+		}
+	}
+}
+
+func TestNetworkName(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", "default"},
+		{NetworkNone, NetworkNone},
+		{NetworkInternal, NetworkInternal},
+	}
+
+	for _, test := range tests {
+		config := AnsibleConfig{NetworkMode: test.mode}
+		if got := config.NetworkName(); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.mode, got, test.want)
+		}
+	}
+}
+
+func TestNetworkPrepare(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	tests := []struct {
+		name     string
+		mode     string
+		network  string
+		want     string
+		commands [][]string
+		err      bool
+	}{
+		{"default", "", "", "", nil, false},
+		{"none", NetworkNone, "", NetworkNone, nil, false},
+		{"none with a network", NetworkNone, "art-test-network", "art-test-network", nil, true},
+		{"internal", NetworkInternal, "", "art-test-network", [][]string{
+			{"network", "ls", "--quiet", "--filter", "name=^art-test-network$"},
+			{"network", "create", "--internal", fmt.Sprintf("--label=%v=art-test", ParentLabel), "art-test-network"},
+		}, false},
+		{"internal with a network", NetworkInternal, "shared", "shared", [][]string{
+			{"network", "ls", "--quiet", "--filter", "name=^shared$"},
+			{"network", "create", "--internal", fmt.Sprintf("--label=%v=art-test", ParentLabel), "shared"},
+		}, false},
+		{"invalid", "host", "", "", nil, true},
+	}
+
+	for _, test := range tests {
+		fake := &FakeExecutor{}
+		executor := CommandExecutor
+		CommandExecutor = fake
+
+		dist := Ubuntu1804
+		dist.CID = "art-test"
+		config := AnsibleConfig{NetworkMode: test.mode, Network: test.network, Quiet: true}
+		err := dist.NetworkPrepare(&config)
+		CommandExecutor = executor
+
+		if (err != nil) != test.err {
+			t.Errorf("%v: got error %v", test.name, err)
+			continue
+		}
+		if err == nil && config.Network != test.want {
+			t.Errorf("%v: got network %q, want %q", test.name, config.Network, test.want)
+		}
+		commands := [][]string{}
+		for _, command := range fake.Commands {
+			commands = append(commands, command.Args)
+		}
+		if test.commands == nil {
+			test.commands = [][]string{}
+		}
+		if !reflect.DeepEqual(commands, test.commands) {
+			t.Errorf("%v: got commands %v, want %v", test.name, commands, test.commands)
+		}
+	}
+}
+
+func TestNetworkTeardown(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	filter := fmt.Sprintf("label=%v=art-test", ParentLabel)
+	fake := &FakeExecutor{
+		Respond: func(command Command) (CommandResult, error) {
+			if reflect.DeepEqual(command.Args, []string{"network", "ls", "--quiet", "--filter", filter}) {
+				return CommandResult{Stdout: "0123456789ab\n"}, nil
+			}
+			return CommandResult{}, nil
+		},
+	}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	dist := Ubuntu1804
+	dist.CID = "art-test"
+	dist.DockerKill(true)
+
+	removed := false
+	for _, command := range fake.Commands {
+		if reflect.DeepEqual(command.Args, []string{"network", "rm", "0123456789ab"}) {
+			removed = true
+		}
+	}
+	if !removed {
+		t.Errorf("the network of the container was not removed: %v", fake.Commands)
+	}
+}
+
+func TestDockerNetworkRemove(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	for _, exists := range []bool{true, false} {
+		fake := &FakeExecutor{
+			Respond: func(command Command) (CommandResult, error) {
+				if command.Args[1] == "ls" && exists {
+					return CommandResult{Stdout: "0123456789ab\n"}, nil
+				}
+				return CommandResult{}, nil
+			},
+		}
+		executor := CommandExecutor
+		CommandExecutor = fake
+		err := DockerNetworkRemove("art-test-network", true)
+		CommandExecutor = executor
+
+		if err != nil {
+			t.Error(err)
+		}
+		want := 1
+		if exists {
+			want = 2
+			if last := fake.Commands[len(fake.Commands)-1].Args; !reflect.DeepEqual(last, []string{"network", "rm", "art-test-network"}) {
+				t.Errorf("got %v, want the network removed", last)
+			}
+		}
+		if len(fake.Commands) != want {
+			t.Errorf("exists %v: got %v commands, want %v", exists, len(fake.Commands), want)
+		}
+	}
+}
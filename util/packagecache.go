@@ -0,0 +1,151 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PackageCacheLabel is the label applied to package cache volumes,
+// the value of which is the distribution the cache belongs to.
+const PackageCacheLabel = "ansible-role-tester.cache"
+
+// PackageCache describes the package manager cache of a Family.
+type PackageCache struct {
+
+	// Paths are the cache directories of the package manager.
+	Paths []string
+
+	// Configure is a shell command configuring the package
+	// manager to keep downloaded packages in the cache.
+	Configure string
+}
+
+var (
+	// aptCache is the package cache for apt based families.
+	aptCache = PackageCache{
+		[]string{"/var/cache/apt/archives"},
+		`rm -f /etc/apt/apt.conf.d/docker-clean && echo 'Binary::apt::APT::Keep-Downloaded-Packages "true";' > /etc/apt/apt.conf.d/01keep-downloads`,
+	}
+
+	// yumCache is the package cache for yum based families.
+	yumCache = PackageCache{
+		[]string{"/var/cache/yum"},
+		`sed -i -e 's/^keepcache=.*/keepcache=1/' /etc/yum.conf && (grep -q '^keepcache=' /etc/yum.conf || echo 'keepcache=1' >> /etc/yum.conf)`,
+	}
+
+	// dnfCache is the package cache for dnf based families.
+	dnfCache = PackageCache{
+		[]string{"/var/cache/dnf"},
+		`sed -i -e 's/^keepcache=.*/keepcache=True/' /etc/dnf/dnf.conf && (grep -q '^keepcache=' /etc/dnf/dnf.conf || echo 'keepcache=True' >> /etc/dnf/dnf.conf)`,
+	}
+
+	// PackageCaches is the package cache of each Family by name.
+	PackageCaches = map[string]PackageCache{
+		CentOS.Name: yumCache,
+		Debian.Name: aptCache,
+		Fedora.Name: dnfCache,
+		Ubuntu.Name: aptCache,
+	}
+)
+
+// packageCacheVolume returns the name of the volume for the cache path.
+func (dist *Distribution) packageCacheVolume(path string) string {
+	name := dist.Distro
+	if name == "" {
+		name = dist.Family.Name
+	}
+	slug := strings.Trim(strings.Replace(path, "/", "-", -1), "-")
+	return strings.ToLower(fmt.Sprintf("ansible-role-tester-cache-%v-%v", name, slug))
+}
+
+// PackageCacheVolumes will return the volumes (in the form name:path)
+// caching the packages of the Distribution. Distributions without
+// a known Family have no package cache.
+func (dist *Distribution) PackageCacheVolumes() []string {
+	volumes := []string{}
+	for _, path := range PackageCaches[dist.Family.Name].Paths {
+		volumes = append(volumes, fmt.Sprintf("%v:%v", dist.packageCacheVolume(path), path))
+	}
+	return volumes
+}
+
+// packageCacheCreate will create the labelled volumes for the package cache.
+func (dist *Distribution) packageCacheCreate() error {
+	for _, path := range PackageCaches[dist.Family.Name].Paths {
+		if _, err := DockerExec([]string{
+			"volume",
+			"create",
+			fmt.Sprintf("--label=%v=%v", PackageCacheLabel, dist.Distro),
+			dist.packageCacheVolume(path),
+		}, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packageCacheConfigureArgs will return the docker arguments which
+// configure the package manager in the container to keep packages, and
+// false when package caches are not supported for the distribution.
+func (dist *Distribution) packageCacheConfigureArgs() ([]string, bool) {
+	cache, ok := PackageCaches[dist.Family.Name]
+	if !ok {
+		return nil, false
+	}
+	return []string{"exec", dist.CID, "sh", "-c", cache.Configure}, true
+}
+
+// PackageCacheConfigure will configure the package manager
+// in the container to keep packages which are downloaded.
+func (dist *Distribution) PackageCacheConfigure(config *AnsibleConfig) bool {
+
+	args, ok := dist.packageCacheConfigureArgs()
+	if !ok {
+		if !config.Quiet {
+			log.Warnf("Package caches are not supported for %v, skipping...", dist.Container)
+		}
+		return false
+	}
+
+	if _, err := DockerExec(args, false); err != nil {
+		log.Errorf("could not configure the package cache: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// PackageCacheList will return the names of all package cache volumes.
+func PackageCacheList() ([]string, error) {
+
+	out, err := DockerExec([]string{
+		"volume",
+		"ls",
+		"--quiet",
+		"--filter",
+		fmt.Sprintf("label=%v", PackageCacheLabel),
+	}, false)
+	if err != nil {
+		return []string{}, err
+	}
+
+	volumes := strings.Fields(out)
+	sort.Strings(volumes)
+	return volumes, nil
+}
+
+// PackageCacheClear will remove all package cache volumes. Volumes which
+// are in use by a container cannot be removed, and are named in the error.
+func PackageCacheClear() error {
+
+	volumes, err := PackageCacheList()
+	if err != nil || len(volumes) == 0 {
+		return err
+	}
+
+	_, err = DockerExec(append([]string{"volume", "rm"}, volumes...), false)
+	return err
+}
@@ -0,0 +1,95 @@
+package util
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestPackageCacheVolumes(t *testing.T) {
+	tests := []struct {
+		dist Distribution
+		want []string
+	}{
+		{Ubuntu1804, []string{"ansible-role-tester-cache-ubuntu1804-var-cache-apt-archives:/var/cache/apt/archives"}},
+		{DebianStretch, []string{"ansible-role-tester-cache-debian9-var-cache-apt-archives:/var/cache/apt/archives"}},
+		{CentOS7, []string{"ansible-role-tester-cache-centos7-var-cache-yum:/var/cache/yum"}},
+		{Fedora28, []string{"ansible-role-tester-cache-fedora28-var-cache-dnf:/var/cache/dnf"}},
+		{Distribution{Family: Family{Name: "Alpine"}}, []string{}},
+	}
+
+	for _, test := range tests {
+		if got := test.dist.PackageCacheVolumes(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.dist.Family.Name, got, test.want)
+		}
+	}
+}
+
+func TestPackageCacheConfigure(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	tests := []struct {
+		dist Distribution
+		want []string
+	}{
+		{Ubuntu1804, []string{"rm -f /etc/apt/apt.conf.d/docker-clean", `Keep-Downloaded-Packages "true"`}},
+		{DebianStretch, []string{"rm -f /etc/apt/apt.conf.d/docker-clean", `Keep-Downloaded-Packages "true"`}},
+		{CentOS7, []string{"keepcache=1", "/etc/yum.conf"}},
+		{Fedora28, []string{"keepcache=True", "/etc/dnf/dnf.conf"}},
+		{Distribution{Family: Family{Name: "Alpine"}}, nil},
+	}
+
+	for _, test := range tests {
+		fake := &FakeExecutor{}
+		executor := CommandExecutor
+		CommandExecutor = fake
+
+		dist := test.dist
+		dist.CID = "art-test"
+		configured := dist.PackageCacheConfigure(&AnsibleConfig{Quiet: true})
+		CommandExecutor = executor
+
+		if configured != (test.want != nil) {
+			t.Errorf("%v: got configured %v", test.dist.Family.Name, configured)
+		}
+		if test.want == nil {
+			if len(fake.Commands) != 0 {
+				t.Errorf("%v: got commands %v, want none", test.dist.Family.Name, fake.Commands)
+			}
+			continue
+		}
+		if len(fake.Commands) != 1 {
+			t.Fatalf("%v: got %v commands, want 1", test.dist.Family.Name, len(fake.Commands))
+		}
+		args := fake.Commands[0].Args
+		if !reflect.DeepEqual(args[:4], []string{"exec", "art-test", "sh", "-c"}) {
+			t.Errorf("%v: got %v", test.dist.Family.Name, args)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(args[4], want) {
+				t.Errorf("%v: %q does not contain %q", test.dist.Family.Name, args[4], want)
+			}
+		}
+	}
+}
+
+func TestPackageCacheCreate(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	fake := &FakeExecutor{}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	dist := CentOS7
+	if err := dist.packageCacheCreate(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"volume", "create", "--label=" + PackageCacheLabel + "=centos7", "ansible-role-tester-cache-centos7-var-cache-yum"}
+	if len(fake.Commands) != 1 || !reflect.DeepEqual(fake.Commands[0].Args, want) {
+		t.Errorf("got %v, want %v", fake.Commands, want)
+	}
+}
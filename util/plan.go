@@ -0,0 +1,210 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	// PlanText prints each command of a plan as it would be typed.
+	PlanText = "text"
+
+	// PlanJSON prints each command of a plan as a JSON object per line.
+	PlanJSON = "json"
+)
+
+// PlanStep is a command of a plan, as printed by PlanExecutor.
+type PlanStep struct {
+	Step    int      `json:"step"`
+	Name    string   `json:"name"`
+	Args    []string `json:"args"`
+	Dir     string   `json:"dir,omitempty"`
+	Env     []string `json:"env,omitempty"`
+	Command string   `json:"command"`
+}
+
+// PlanExecutor is an Executor which prints the commands of a test in
+// order instead of running them. Commands which only query Docker are
+// not printed, and are answered as if every step so far succeeded so
+// the test continues through every stage. Git commands only read the
+// repository of the role for the report, and are run.
+type PlanExecutor struct {
+	Writer io.Writer
+	Format string
+
+	step    int
+	running map[string]bool
+	mu      sync.Mutex
+}
+
+// NewPlanExecutor will return a PlanExecutor printing to the writer.
+func NewPlanExecutor(writer io.Writer, format string) (*PlanExecutor, error) {
+	if format != PlanText && format != PlanJSON {
+		return nil, fmt.Errorf("invalid plan format %v, expected %v or %v", format, PlanText, PlanJSON)
+	}
+	return &PlanExecutor{
+		Writer:  writer,
+		Format:  format,
+		running: map[string]bool{},
+	}, nil
+}
+
+// planning will return true if commands are only planned by
+// CommandExecutor, so nothing should be written to the host.
+func planning() bool {
+	_, ok := CommandExecutor.(*PlanExecutor)
+	return ok
+}
+
+// Started will mark the container as running, for plans of
+// commands which operate on a container started earlier.
+func (p *PlanExecutor) Started(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running[name] = true
+}
+
+// planQuery will return true if the docker arguments only query Docker.
+func planQuery(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "ps", "images", "inspect":
+		return true
+	case "image", "network", "volume":
+		return len(args) > 1 && (args[1] == "inspect" || args[1] == "ls")
+	}
+	return false
+}
+
+// planFilters will return the values of the filters in the docker arguments.
+func planFilters(args []string) []string {
+	filters := []string{}
+	for i, arg := range args {
+		if (arg == "--filter" || arg == "-f") && i+1 < len(args) {
+			filters = append(filters, args[i+1])
+		}
+	}
+	return filters
+}
+
+// respond will return the output of a command as if it succeeded,
+// tracking which containers the plan has started.
+func (p *PlanExecutor) respond(command Command) CommandResult {
+
+	result := CommandResult{}
+	args := command.Args
+
+	if command.Name == "ansible-playbook" {
+		for _, arg := range args {
+			if arg == "--list-hosts" {
+				result.Stdout = "  pattern: ['all']\n"
+				return result
+			}
+		}
+	}
+
+	if command.Name != "docker" || len(args) == 0 {
+		return result
+	}
+
+	switch args[0] {
+	case "run":
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "--name=") {
+				p.running[strings.TrimPrefix(arg, "--name=")] = true
+			}
+		}
+	case "rename":
+		if len(args) == 3 && p.running[args[1]] {
+			delete(p.running, args[1])
+			p.running[args[2]] = true
+		}
+	case "stop", "rm":
+		for _, arg := range args[1:] {
+			delete(p.running, arg)
+		}
+	case "ps":
+		// Only running containers started by the plan are listed.
+		for _, filter := range planFilters(args) {
+			if strings.HasPrefix(filter, "label=") {
+				return result
+			}
+		}
+		for name := range p.running {
+			matches := true
+			for _, filter := range planFilters(args) {
+				if strings.HasPrefix(filter, "name=") && !strings.Contains(name, strings.TrimPrefix(filter, "name=")) {
+					matches = false
+				}
+			}
+			if matches {
+				result.Stdout += fmt.Sprintf("'%v'\n", name)
+			}
+		}
+	case "images":
+		// Images are assumed to be present.
+		result.Stdout = "plan\n"
+	case "inspect":
+		result.Stdout = "running none\n"
+	case "exec":
+		// Playbooks run in the container report no changes.
+		for _, arg := range args {
+			if arg == "ansible-playbook" {
+				result.Stdout = "localhost : ok=0 changed=0 unreachable=0 failed=0\n"
+			}
+		}
+	}
+
+	return result
+}
+
+// print will write the command as the next step of the plan.
+func (p *PlanExecutor) print(command Command) {
+
+	p.step++
+
+	if p.Format == PlanJSON {
+		data, _ := json.Marshal(PlanStep{
+			Step:    p.step,
+			Name:    command.Name,
+			Args:    command.Args,
+			Dir:     command.Dir,
+			Env:     command.Env,
+			Command: command.String(),
+		})
+		fmt.Fprintln(p.Writer, string(data))
+		return
+	}
+
+	line := command.String()
+	if len(command.Env) > 0 {
+		line = strings.Join(command.Env, " ") + " " + line
+	}
+	if command.Dir != "" {
+		line = fmt.Sprintf("(cd %v && %v)", command.Dir, line)
+	}
+	fmt.Fprintf(p.Writer, "%3d  %v\n", p.step, line)
+}
+
+// Execute will print the command unless it only queries
+// Docker, and return its output as if it succeeded.
+func (p *PlanExecutor) Execute(command Command) (CommandResult, error) {
+
+	if command.Name == "git" {
+		return (&ExecExecutor{}).Execute(command)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if command.Name != "docker" || !planQuery(command.Args) {
+		p.print(command)
+	}
+
+	return p.respond(command), nil
+}
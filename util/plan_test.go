@@ -0,0 +1,99 @@
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestPlanExecutor(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	var out bytes.Buffer
+	plan, err := NewPlanExecutor(&out, PlanText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := CommandExecutor
+	CommandExecutor = plan
+	defer func() { CommandExecutor = executor }()
+
+	dist := Ubuntu1804
+	dist.CID = "art-test"
+	config := AnsibleConfig{
+		HostPath:   "/home/user/ansible-role-example",
+		RemotePath: "/etc/ansible/roles/role_under_test",
+		Quiet:      true,
+	}
+
+	if !dist.DockerRun(&config, &AnsibleReport{}) {
+		t.Error("the planned container is not running")
+	}
+	dist.DockerKill(true)
+	if dist.DockerCheck() {
+		t.Error("the planned container is still running")
+	}
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %v steps, want 3:\n%v", len(lines), out.String())
+	}
+	if !strings.HasPrefix(lines[0], "  1  docker run --detach --name=art-test") {
+		t.Errorf("got first step %q", lines[0])
+	}
+	if lines[2] != "  3  docker rm art-test" {
+		t.Errorf("got last step %q", lines[2])
+	}
+
+	if _, err := NewPlanExecutor(&out, "yaml"); err == nil {
+		t.Error("an invalid format was accepted")
+	}
+}
+
+func TestPlanGalaxyCache(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "requirements.yml"), []byte("---\n- src: geerlingguy.java\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := NewPlanExecutor(ioutil.Discard, PlanText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := CommandExecutor
+	CommandExecutor = plan
+	defer func() { CommandExecutor = executor }()
+
+	root := filepath.Join(dir, "galaxy")
+	config := AnsibleConfig{
+		HostPath:         dir,
+		RequirementsFile: "requirements.yml",
+		Quiet:            true,
+	}
+	if err := PrepareGalaxyCache(&config, root); err != nil {
+		t.Fatal(err)
+	}
+	if config.GalaxyCache == "" {
+		t.Error("the planned galaxy cache was not assigned")
+	}
+
+	dist := Ubuntu1804
+	dist.CID = "art-test"
+	if !dist.galaxyCacheInstall(&config) {
+		t.Error("the planned galaxy cache was not installed")
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Errorf("the galaxy cache was written to the host when it was planned: %v", err)
+	}
+}
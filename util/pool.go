@@ -0,0 +1,164 @@
+package util
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PoolLabel is the label applied to pooled containers, the value
+	// of which identifies the configuration they were started with.
+	PoolLabel = "ansible-role-tester.pool"
+
+	// poolPrefix is the name prefix of containers waiting in a pool.
+	// Containers are renamed when they are taken from the pool.
+	poolPrefix = "ansible-role-tester-pool-"
+)
+
+// poolArgs will return the arguments to start a container for the
+// configuration and its pool key, which identifies every container
+// started with the same arguments regardless of its name. The arguments
+// are built with an empty report, so the key only depends on the
+// configuration and not on volumes already recorded in a report. Extra
+// hosts and environment are left out, as they change between runs.
+func (dist *Distribution) poolArgs(config *AnsibleConfig) ([]string, string) {
+
+	pooled := *config
+	pooled.ExtraHosts = nil
+	pooled.Env = nil
+	args := buildDockerArgs(dist, &pooled, &AnsibleReport{})
+
+	hash := sha256.New()
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--name=") {
+			fmt.Fprintln(hash, arg)
+		}
+	}
+	key := fmt.Sprintf("%x", hash.Sum(nil))[:12]
+
+	return args, key
+}
+
+// poolContainers will return the names of the containers
+// waiting in the pool for the key, oldest first.
+func poolContainers(key string) []string {
+
+	filters := []string{"--filter", fmt.Sprintf("name=%v", poolPrefix)}
+	if key != "" {
+		filters = append(filters, "--filter", fmt.Sprintf("label=%v=%v", PoolLabel, key))
+	}
+
+	out, err := DockerExec(append([]string{
+		"ps",
+		"--filter",
+		"status=running",
+		"--format",
+		"{{.Names}}",
+	}, filters...), false)
+	if err != nil {
+		return []string{}
+	}
+
+	names := strings.Fields(out)
+	sort.Strings(names)
+	return names
+}
+
+// poolUsable will identify if pooled containers can be used for the
+// configuration. They are started before the network, extra hosts and
+// environment of a run are known, so they cannot be used with them.
+func poolUsable(config *AnsibleConfig) bool {
+	return config.Network == "" && len(config.ExtraHosts) == 0 && len(config.Env) == 0
+}
+
+// PoolTake will take a running container for the configuration from the
+// pool and rename it to the name of the Distribution, returning true if
+// one was available. Containers taken from the pool have already booted.
+func (dist *Distribution) PoolTake(config *AnsibleConfig, report *AnsibleReport) bool {
+
+	if !poolUsable(config) {
+		if !config.Quiet {
+			log.Warnln("Pooled containers cannot be used with a network, fixtures or extra environment, skipping...")
+		}
+		return false
+	}
+
+	_, key := dist.poolArgs(config)
+	for _, name := range poolContainers(key) {
+		if _, err := DockerExec([]string{
+			"rename",
+			name,
+			dist.CID,
+		}, false); err == nil {
+			if !config.Quiet {
+				log.Infof("Took %v from the pool as %v", name, dist.CID)
+			}
+			// Record the volumes of the container as if it had been started.
+			buildDockerArgs(dist, config, report)
+			return true
+		}
+	}
+
+	return false
+}
+
+// PoolFill will start containers for the configuration in the background
+// until the pool contains config.Pool containers. Containers are started
+// and configured by a detached process, so the current tests don't wait
+// for them and they keep booting after the program has exited.
+func (dist *Distribution) PoolFill(config *AnsibleConfig) {
+
+	if !poolUsable(config) {
+		return
+	}
+
+	_, key := dist.poolArgs(config)
+	for i := len(poolContainers(key)); i < config.Pool; i++ {
+
+		pooled := *dist
+		pooled.CID = fmt.Sprintf("%v%v-%v", poolPrefix, key, time.Now().UnixNano())
+
+		args, _ := pooled.poolArgs(config)
+		args = append([]string{args[0], fmt.Sprintf("--label=%v=%v", PoolLabel, key)}, args[1:]...)
+
+		script := Command{Name: "docker", Args: args}.String()
+		if configure, ok := pooled.packageCacheConfigureArgs(); ok && config.PackageCache {
+			script += " && " + Command{Name: "docker", Args: configure}.String()
+		}
+
+		if !config.Quiet {
+			log.Printf("Adding %v to the pool", pooled.CID)
+		}
+
+		if _, err := execute(Command{
+			Name:   "sh",
+			Args:   []string{"-c", script},
+			Detach: true,
+		}); err != nil {
+			log.Errorf("could not add a container to the pool: %v", err)
+			return
+		}
+	}
+}
+
+// PoolList will return the names of all containers waiting in a pool.
+func PoolList() []string {
+	return poolContainers("")
+}
+
+// PoolDrain will remove all containers waiting in a pool.
+func PoolDrain() error {
+
+	names := PoolList()
+	if len(names) == 0 {
+		return nil
+	}
+
+	_, err := DockerExec(append([]string{"rm", "--force", "--volumes"}, names...), false)
+	return err
+}
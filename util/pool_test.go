@@ -0,0 +1,114 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestPoolTakeKey(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	fake := &FakeExecutor{}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	dist := Ubuntu1804
+	dist.CID = "art-test"
+	config := AnsibleConfig{
+		HostPath:   "/home/user/ansible-role-example",
+		RemotePath: "/etc/ansible/roles/role_under_test",
+		Pool:       1,
+		Quiet:      true,
+	}
+	_, key := dist.poolArgs(&config)
+
+	// Volumes already in the report do not change the key.
+	report := AnsibleReport{}
+	report.Docker.Volumes = []string{"/srv/other:/srv/other"}
+	dist.PoolTake(&config, &report)
+
+	label := fmt.Sprintf("label=%v=%v", PoolLabel, key)
+	for _, command := range fake.Commands {
+		if len(command.Args) > 0 && command.Args[0] == "ps" && !contains(command.Args, label) {
+			t.Errorf("pool containers were listed without %v: %v", label, command.Args)
+		}
+	}
+	if _, again := dist.poolArgs(&config); again != key {
+		t.Errorf("pool key changed from %v to %v", key, again)
+	}
+}
+
+func TestPoolArgs(t *testing.T) {
+	dist := Ubuntu1804
+	dist.CID = "art-test"
+	config := AnsibleConfig{
+		HostPath:   "/home/user/ansible-role-example",
+		RemotePath: "/etc/ansible/roles/role_under_test",
+	}
+	args, key := dist.poolArgs(&config)
+
+	// Fixtures are served on a different port for each run.
+	config.ExtraHosts = []string{"fixtures:host-gateway"}
+	config.Env = []string{"FIXTURES_URL=http://fixtures:40123"}
+	withFixtures, again := dist.poolArgs(&config)
+	if again != key {
+		t.Errorf("pool key changed from %v to %v with extra hosts and environment", key, again)
+	}
+	if strings.Join(withFixtures, " ") != strings.Join(args, " ") {
+		t.Errorf("got %v, want %v", withFixtures, args)
+	}
+	if poolUsable(&config) {
+		t.Error("pooled containers were usable with extra hosts and environment")
+	}
+}
+
+func TestPoolFill(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	fake := &FakeExecutor{}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	dist := CentOS7
+	dist.CID = "art-test"
+	config := AnsibleConfig{
+		HostPath:     "/home/user/ansible-role-example",
+		RemotePath:   "/etc/ansible/roles/role_under_test",
+		Pool:         2,
+		PackageCache: true,
+		Quiet:        true,
+	}
+	dist.PoolFill(&config)
+
+	fills := []Command{}
+	for _, command := range fake.Commands {
+		if command.Name == "sh" {
+			fills = append(fills, command)
+		}
+	}
+	if len(fills) != 2 {
+		t.Fatalf("got %v commands filling the pool, want 2: %v", len(fills), fake.Commands)
+	}
+	for _, command := range fills {
+		if !command.Detach {
+			t.Errorf("the pool was filled by a command which was waited for: %v", command)
+		}
+		script := command.Args[len(command.Args)-1]
+		if !strings.HasPrefix(script, "docker run --label="+PoolLabel+"=") || !strings.Contains(script, " && docker exec "+poolPrefix) || !strings.Contains(script, "keepcache") {
+			t.Errorf("the pooled container is not started and configured: %v", script)
+		}
+	}
+
+	fake.Commands = nil
+	config.Env = []string{"FIXTURES_URL=http://fixtures:40123"}
+	dist.PoolFill(&config)
+	if len(fake.Commands) != 0 {
+		t.Errorf("the pool was filled with extra environment: %v", fake.Commands)
+	}
+}
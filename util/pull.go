@@ -0,0 +1,216 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PullAlways will pull the image before every run.
+	PullAlways = "always"
+
+	// PullMissing will pull the image only if it is not available locally.
+	PullMissing = "missing"
+
+	// PullNever will never pull the image, and fail if it is not available.
+	PullNever = "never"
+)
+
+// PullResult is the outcome of pulling a single image.
+type PullResult struct {
+	Image  string
+	Digest string
+	Error  error
+}
+
+// ValidPullPolicy will return an error if the input is not a known pull policy.
+func ValidPullPolicy(policy string) error {
+	switch policy {
+	case PullAlways, PullMissing, PullNever:
+		return nil
+	}
+	return fmt.Errorf("invalid pull policy '%v', expected one of %v, %v or %v", policy, PullAlways, PullMissing, PullNever)
+}
+
+// DockerPullImage will pull the specified image from its registry, using
+// any credentials available for the registry. Authentication failures
+// are returned as a RegistryAuthError.
+func DockerPullImage(image string, quiet bool) error {
+
+	if !quiet {
+		log.Printf("Pulling %v", image)
+	}
+
+	args, creds, cleanup, err := dockerRegistryArgs("pull", image, quiet)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	if _, stderr, err := DockerExecOutput(args, !quiet); err != nil {
+		if isAuthFailure(stderr) {
+			ref, _ := ParseImageReference(image)
+			authErr := &RegistryAuthError{
+				Registry: registryServer(ref.Registry),
+				Image:    image,
+				Output:   stderr,
+			}
+			if creds != nil {
+				authErr.Source = creds.Source
+			}
+			return authErr
+		}
+		return fmt.Errorf("could not pull %v: %v", image, err)
+	}
+
+	return nil
+}
+
+// DockerPull will ensure the image for the Distribution is available
+// locally according to the specified pull policy. The image is pinned
+// to the Digest of the Distribution first, when it has one.
+func (dist *Distribution) DockerPull(policy string, quiet bool) error {
+
+	if err := ValidPullPolicy(policy); err != nil {
+		return err
+	}
+
+	if dist.Digest != "" {
+		if err := dist.PinDigest(dist.Digest); err != nil {
+			return fmt.Errorf("could not pin image to digest: %v", err)
+		}
+	}
+
+	return DockerPullPolicy(dist.Container, policy, quiet)
+}
+
+// DockerPullPolicy will ensure the image is available locally
+// according to the specified pull policy, see DockerPullImage.
+func DockerPullPolicy(image, policy string, quiet bool) error {
+
+	if err := ValidPullPolicy(policy); err != nil {
+		return err
+	}
+
+	switch policy {
+	case PullNever:
+		if !DockerImageExists(image) {
+			return fmt.Errorf("image %v is not available locally and the pull policy is '%v'", image, policy)
+		}
+		return nil
+	case PullMissing:
+		if DockerImageExists(image) {
+			return nil
+		}
+	}
+
+	return DockerPullImage(image, quiet)
+}
+
+// PinDigest will pin the Distribution image to the specified digest,
+// so the exact same image is used regardless of where the tag points.
+func (dist *Distribution) PinDigest(digest string) error {
+
+	ref, err := ParseImageReference(dist.Container)
+	if err != nil {
+		return err
+	}
+
+	ref.Digest = digest
+	pinned, err := ParseImageReference(ref.String())
+	if err != nil {
+		return err
+	}
+
+	dist.Container = pinned.String()
+	dist.Digest = pinned.Digest
+	return nil
+}
+
+// ImageDigest will return the repository digest of a local image, which
+// uniquely identifies the image content in its registry. Images which have
+// never been pushed or pulled have no repository digest, in which case the
+// local image ID is returned instead.
+func ImageDigest(image string) (string, error) {
+
+	out, err := DockerExec([]string{
+		"image",
+		"inspect",
+		"--format",
+		"{{range .RepoDigests}}{{println .}}{{end}}{{.Id}}",
+		image,
+	}, false)
+
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return "", errors.New("could not inspect image " + image)
+	}
+
+	// Prefer the digest which belongs to the same repository.
+	ref, _ := ParseImageReference(image)
+	for _, line := range lines[:len(lines)-1] {
+		i := strings.Index(line, "@")
+		if i < 0 {
+			continue
+		}
+		if repo, err := ParseImageReference(line[:i]); err == nil && repo.Repository == ref.Repository {
+			return line[i+1:], nil
+		}
+	}
+
+	if len(lines) > 1 {
+		if i := strings.Index(lines[0], "@"); i >= 0 {
+			return lines[0][i+1:], nil
+		}
+	}
+
+	return lines[len(lines)-1], nil
+}
+
+// parallelImages will run fn for every image with at most parallel
+// invocations running at once. Results are returned in the same
+// order as the input images.
+func parallelImages(images []string, parallel int, fn func(image string) PullResult) []PullResult {
+
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]PullResult, len(images))
+	queue := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i, image := range images {
+		wg.Add(1)
+		go func(i int, image string) {
+			defer wg.Done()
+			queue <- struct{}{}
+			defer func() { <-queue }()
+			results[i] = fn(image)
+		}(i, image)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// DockerPullAll will pull every specified image with at most
+// parallel pulls running at once. Results are returned in the
+// same order as the input images.
+func DockerPullAll(images []string, parallel int) []PullResult {
+	return parallelImages(images, parallel, func(image string) PullResult {
+		result := PullResult{Image: image}
+		if result.Error = DockerPullImage(image, true); result.Error == nil {
+			result.Digest, result.Error = ImageDigest(image)
+		}
+		return result
+	})
+}
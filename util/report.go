@@ -1,84 +1,103 @@
 package util
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
 )
 
+const (
+	// ReportYAML writes the report as YAML.
+	ReportYAML = "yaml"
+
+	// ReportJSON writes the report as JSON.
+	ReportJSON = "json"
+
+	// ReportMarkdown writes a summary of the report as Markdown.
+	ReportMarkdown = "md"
+
+	// ReportHTML writes the report as a single HTML page.
+	ReportHTML = "html"
+
+	// GitHubStepSummaryEnv is the environment variable naming the step
+	// summary file in GitHub Actions, which reports are appended to.
+	GitHubStepSummaryEnv = "GITHUB_STEP_SUMMARY"
+)
+
+// ReportFormats is every format a report can be written in.
+var ReportFormats = []string{ReportYAML, ReportJSON, ReportMarkdown, ReportHTML}
+
 // AnsibleReport will contain metadata about the run which will be, is and has executed.
+// It is written in the schema published in schema/report.schema.json, the version
+// of which is recorded in SchemaVersion.
 type AnsibleReport struct {
-	Meta struct {
-		Timestamp    time.Time
-		Repository   string
-		CommitHash   string
-		LocalChanges bool
-		ReportFile   string
-	}
-	Ansible struct {
-		Config       AnsibleConfig
-		Distribution Distribution
-		Hosts        []string
-		Syntax       bool
-		Requirements bool
+	SchemaVersion string `json:"schema_version" yaml:"schema_version"`
+	Meta          struct {
+		Timestamp    time.Time `json:"timestamp" yaml:"timestamp"`
+		Repository   string    `json:"repository" yaml:"repository"`
+		CommitHash   string    `json:"commit_hash" yaml:"commit_hash"`
+		LocalChanges bool      `json:"local_changes" yaml:"local_changes"`
+		ReportFile   string    `json:"report_file" yaml:"report_file"`
+		ReportFormat string    `json:"report_format" yaml:"report_format"`
+		Artifacts    string    `json:"artifacts" yaml:"artifacts"`
+	} `json:"meta" yaml:"meta"`
+	Environment Environment `json:"environment" yaml:"environment"`
+	Ansible     struct {
+		Config       AnsibleConfig  `json:"config" yaml:"config"`
+		Distribution Distribution   `json:"distribution" yaml:"distribution"`
+		Instances    []Distribution `json:"instances" yaml:"instances"`
+		Hosts        []string       `json:"hosts" yaml:"hosts"`
+		Syntax       bool           `json:"syntax" yaml:"syntax"`
+		Requirements bool           `json:"requirements" yaml:"requirements"`
+		Prepare      bool           `json:"prepare" yaml:"prepare"`
+		Skipped      []string       `json:"skipped" yaml:"skipped"`
 		Run          struct {
-			Result bool
-			Time   time.Duration
-		}
+			Result bool          `json:"result" yaml:"result"`
+			Time   time.Duration `json:"time" yaml:"time"`
+		} `json:"run" yaml:"run"`
 		Idempotence struct {
-			Result bool
-			Time   time.Duration
-		}
-	}
+			Result  bool          `json:"result" yaml:"result"`
+			Time    time.Duration `json:"time" yaml:"time"`
+			Changed []string      `json:"changed" yaml:"changed"`
+		} `json:"idempotence" yaml:"idempotence"`
+	} `json:"ansible" yaml:"ansible"`
 	Docker struct {
-		Run     bool
-		Kill    bool
-		Volumes []string
-	}
+		Run      bool     `json:"run" yaml:"run"`
+		Kill     bool     `json:"kill" yaml:"kill"`
+		Pull     string   `json:"pull" yaml:"pull"`
+		Digest   string   `json:"digest" yaml:"digest"`
+		Network  string   `json:"network" yaml:"network"`
+		Snapshot string   `json:"snapshot" yaml:"snapshot"`
+		Volumes  []string `json:"volumes" yaml:"volumes"`
+		Sidecars []string `json:"sidecars" yaml:"sidecars"`
+	} `json:"docker" yaml:"docker"`
+	Stages []StageResult `json:"stages" yaml:"stages"`
 }
 
 // GitCmd will run git commands in the specified directory.
 func GitCmd(path string, args []string) (string, error) {
-	// Find git.
-	git, err := exec.LookPath("git")
-	if err != nil {
-		log.Errorln(err)
-	}
 
-	// Generate the command, based on input.
-	cmd := exec.Cmd{}
-	cmd.Path = git
-	cmd.Dir = path
-	cmd.Args = args
-
-	// Create a buffer for the output.
-	var out bytes.Buffer
-	multi := io.MultiWriter(&out)
-
-	// Assign the output to the writer.
-	cmd.Stdout = multi
+	// The first argument is the name of the command.
+	if len(args) > 0 {
+		args = args[1:]
+	}
 
-	// Check the errors, return as needed.
-	var wg sync.WaitGroup
-	wg.Add(1)
-	if err := cmd.Run(); err != nil {
+	result, err := execute(Command{
+		Name: "git",
+		Args: args,
+		Dir:  path,
+	})
+	if err != nil {
 		log.Errorln(err)
-		return out.String(), err
 	}
-	wg.Done()
 
-	// Return out output as a string.
-	return out.String(), nil
+	return result.Stdout, err
 }
 
 // isGit will identify if the path is a git repository.
@@ -144,6 +163,8 @@ func NewReport(config *AnsibleConfig) AnsibleReport {
 	}
 
 	// Set appropriate defaults as needed.
+	report.SchemaVersion = ReportSchemaVersion
+	report.Environment = NewEnvironment()
 	report.Meta.Timestamp = time.Now()
 	report.Ansible.Config = *config
 	report.Ansible.Syntax = false
@@ -190,47 +211,54 @@ func (report *AnsibleReport) GetYAML(data interface{}) ([]byte, error) {
 
 }
 
-// printFile will output the input data to the given filename.
-// Intended for exclusive use by GetJSON and GetYAML.
+// printFile will output the input data to the given filename, replacing
+// the file unless it is the GitHub Actions step summary, which Markdown
+// is appended to so the summaries of earlier commands are kept.
+// Intended for exclusive use by GetJSON, GetYAML, GetHTML and GetMarkdown.
 func (report *AnsibleReport) printFile(data []byte) (err error) {
 
 	filename := report.Meta.ReportFile
 
-	// If the file already exists, we should delete it.
-	if _, err := os.Stat(filename); err == nil {
-		// The file exists.
-		if err = os.Remove(filename); err != nil {
-			// The file could not be deleted
-			log.Errorf("failed to delete %v\n", filename)
-			return err
-		}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if stepSummary(filename) && report.ReportFormat() == ReportMarkdown {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
 	}
 
-	// Assume no file is available.
-	if _, err := os.Stat(filename); err != nil {
-		if file, err := os.Create(filename); err != nil {
-			// File could not be created.
-			log.Errorf("could not create file %v\n", filename)
-			return err
-		} else {
-			// File was created, attempt to write to it
-			if err = ioutil.WriteFile(filename, data, 0644); err != nil {
-				// Could not write to file.
-				log.Errorf("could not write data to %v\n", filename)
-				return err
-			} else {
-				// Wrote to file successfully.
-				log.Infof("Report data has been written to %v\n", filename)
-			}
-			// Close the file.
-			file.Sync()
-			defer file.Close()
-		}
+	file, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		// File could not be created.
+		log.Errorf("could not create file %v\n", filename)
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.Write(data); err != nil {
+		// Could not write to file.
+		log.Errorf("could not write data to %v\n", filename)
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		log.Errorf("could not write data to %v\n", filename)
+		return err
 	}
+
+	// Wrote to file successfully.
+	log.Infof("Report data has been written to %v\n", filename)
 	return
 
 }
 
+// stepSummary will identify if the file is the GitHub Actions step summary.
+func stepSummary(filename string) bool {
+	summary := os.Getenv(GitHubStepSummaryEnv)
+	if summary == "" {
+		return false
+	}
+	a, aerr := filepath.Abs(filename)
+	b, berr := filepath.Abs(summary)
+	return aerr == nil && berr == nil && a == b
+}
+
 // Printf will print the report in a formatted way.
 func (report *AnsibleReport) Printf() {
 
@@ -245,29 +273,106 @@ func (report *AnsibleReport) Printf() {
 		fmt.Printf("Local changes: \t\t\t%v\n", report.Meta.LocalChanges)
 	}
 	fmt.Println("----------------------------------------------------------")
+	report.Environment.Printf()
+	fmt.Println("----------------------------------------------------------")
 	fmt.Printf("Syntax check: \t\t\t%v\n", report.Ansible.Syntax)
 	fmt.Printf("Requirements installed: \t%v\n", report.Ansible.Requirements)
+	if report.Ansible.Config.PrepareFile != "" {
+		fmt.Printf("Prepare result: \t\t%v\n", report.Ansible.Prepare)
+	}
 	fmt.Printf("Run result: \t\t\t%v\n", report.Ansible.Run.Result)
 	fmt.Printf("Run time: \t\t\t%v\n", report.Ansible.Run.Time)
 	fmt.Printf("Idempotence result: \t\t%v\n", report.Ansible.Idempotence.Result)
 	fmt.Printf("Idempotence time: \t\t%v\n", report.Ansible.Idempotence.Time)
+	for _, task := range report.Ansible.Idempotence.Changed {
+		fmt.Printf("  changed: \t\t\t%v\n", task)
+	}
+	if len(report.Ansible.Skipped) > 0 {
+		fmt.Printf("Skipped stages: \t\t%v\n", strings.Join(report.Ansible.Skipped, ", "))
+	}
+	if len(report.Stages) > 0 {
+		fmt.Println("----------------------------------------------------------")
+		for _, stage := range report.Stages {
+			fmt.Printf("%-24v\t%v in %v (exit %v)\n", "Stage "+stage.Name+":", stage.Status(), stage.Duration.Round(time.Millisecond), stage.ExitCode)
+			if stage.Output != "" {
+				fmt.Printf("  output: \t\t\t%v\n", stage.Output)
+			}
+		}
+	}
+	if report.Meta.Artifacts != "" {
+		fmt.Printf("Artifacts: \t\t\t%v\n", report.Meta.Artifacts)
+	}
 	fmt.Println("----------------------------------------------------------")
 	fmt.Printf("Docker run: \t\t\t%v\n", report.Docker.Run)
 	fmt.Printf("Docker kill: \t\t\t%v\n", report.Docker.Kill)
+	if report.Docker.Network != "" {
+		fmt.Printf("Docker network: \t\t%v\n", report.Docker.Network)
+	}
+	if report.Docker.Snapshot != "" {
+		fmt.Printf("Docker snapshot: \t\t%v\n", report.Docker.Snapshot)
+	}
+	if report.Docker.Digest != "" {
+		fmt.Printf("Docker image digest: \t\t%v\n", report.Docker.Digest)
+	}
 	fmt.Println("----------------------------------------------------------")
 	fmt.Println()
 
-	if strings.HasSuffix(report.Meta.ReportFile, ".yaml") {
-		yamlReport, _ := report.GetYAML(report)
-		report.printFile(yamlReport)
+	report.WriteFile()
+}
+
+// ReportFormat will return the format the report is written in, which
+// is Meta.ReportFormat, or otherwise the format matching the extension
+// of Meta.ReportFile. An empty string is returned for other extensions.
+func (report *AnsibleReport) ReportFormat() string {
+
+	if report.Meta.ReportFormat != "" {
+		return report.Meta.ReportFormat
+	}
+
+	switch filepath.Ext(report.Meta.ReportFile) {
+	case ".yaml", ".yml":
+		return ReportYAML
+	case ".json":
+		return ReportJSON
+	case ".md":
+		return ReportMarkdown
+	case ".html":
+		return ReportHTML
+	}
+	return ""
+}
+
+// WriteFile will write the report to Meta.ReportFile in the format
+// returned by ReportFormat, which is one of ReportFormats.
+func (report *AnsibleReport) WriteFile() {
+
+	if report.Meta.ReportFile == "" {
+		return
+	}
+
+	// The step summary is rendered as Markdown with the summaries of earlier steps.
+	if stepSummary(report.Meta.ReportFile) && report.ReportFormat() != ReportMarkdown {
+		log.Errorf("only %v reports can be written to $%v, use --report-format %v", ReportMarkdown, GitHubStepSummaryEnv, ReportMarkdown)
+		return
 	}
-	if strings.HasSuffix(report.Meta.ReportFile, ".yml") {
+
+	switch report.ReportFormat() {
+	case ReportYAML:
 		yamlReport, _ := report.GetYAML(report)
 		report.printFile(yamlReport)
-	}
-	if strings.HasSuffix(report.Meta.ReportFile, ".json") {
+	case ReportJSON:
 		jsonReport, _ := report.GetJSON(report)
 		report.printFile(jsonReport)
+	case ReportMarkdown:
+		report.printFile(report.GetMarkdown())
+	case ReportHTML:
+		htmlReport, err := report.GetHTML()
+		if err != nil {
+			log.Errorln(err)
+		}
+		report.printFile(htmlReport)
+	default:
+		log.Errorf("could not determine the format of %v, expected one of %v", report.Meta.ReportFile, strings.Join(ReportFormats, ", "))
 	}
 
 }
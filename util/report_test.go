@@ -0,0 +1,76 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestWriteFile(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	summary := filepath.Join(dir, "step_summary")
+	if err := ioutil.WriteFile(summary, []byte("# Lint\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, set := os.LookupEnv(GitHubStepSummaryEnv)
+	os.Setenv(GitHubStepSummaryEnv, summary)
+	defer func() {
+		if set {
+			os.Setenv(GitHubStepSummaryEnv, env)
+		} else {
+			os.Unsetenv(GitHubStepSummaryEnv)
+		}
+	}()
+
+	report := AnsibleReport{}
+	report.Ansible.Distribution = Ubuntu1804
+	report.Meta.ReportFile = summary
+	report.Meta.ReportFormat = ReportMarkdown
+	report.WriteFile()
+	report.WriteFile()
+
+	data, err := ioutil.ReadFile(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# Lint\n") {
+		t.Error("the step summary was replaced by the report")
+	}
+	if markdown := string(report.GetMarkdown()); strings.Count(string(data), markdown) != 2 {
+		t.Error("the reports were not appended to the step summary")
+	}
+
+	// Only Markdown is written to the step summary.
+	for _, format := range []string{ReportYAML, ReportJSON, ReportHTML} {
+		report.Meta.ReportFormat = format
+		report.WriteFile()
+		if written, _ := ioutil.ReadFile(summary); string(written) != string(data) {
+			t.Errorf("a %v report was written to the step summary", format)
+		}
+	}
+
+	// Other files are replaced.
+	other := filepath.Join(dir, "report.json")
+	report.Meta.ReportFile = other
+	report.Meta.ReportFormat = ""
+	report.WriteFile()
+	report.WriteFile()
+	data, err = ioutil.ReadFile(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json, _ := report.GetJSON(&report); string(data) != string(json) {
+		t.Errorf("%v was not replaced by the report", other)
+	}
+}
@@ -23,6 +23,17 @@ func (config *AnsibleConfig) IsAnsibleRole() bool {
 func (dist *Distribution) RoleInstall(config *AnsibleConfig) bool {
 
 	if config.RequirementsFile != "" {
+		if config.GalaxyCache != "" {
+			if config.GalaxyCacheComplete() {
+				if !config.Quiet {
+					log.Infof("Using cached requirements from %v\n", config.GalaxyCache)
+				}
+				return true
+			}
+			log.Printf("Installing requirements to cache %v\n", config.GalaxyCache)
+			return dist.galaxyCacheInstall(config)
+		}
+
 		req := fmt.Sprintf("%v/%v", config.RemotePath, config.RequirementsFile)
 		log.Printf("Installing requirements from %v\n", req)
 		args := []string{
@@ -161,3 +172,62 @@ func (dist *Distribution) RoleTest(config *AnsibleConfig) (bool, time.Duration)
 	}
 	return true, time.Since(now)
 }
+
+// RolePrepare will execute the prepare playbook, if configured, to
+// prepare the container before the role is tested. The prepare
+// playbook is not checked for idempotence.
+func (dist *Distribution) RolePrepare(config *AnsibleConfig) bool {
+
+	if config.PrepareFile == "" {
+		return true
+	}
+
+	if !config.Quiet {
+		log.Infoln("Preparing the container...")
+	}
+
+	var err error
+	if !config.Remote {
+		args := []string{
+			"exec",
+			"--tty",
+			dist.CID,
+			"ansible-playbook",
+			fmt.Sprintf("%v/%v", config.RemotePath, config.PrepareFile),
+		}
+
+		// Add inventory file if configured
+		if config.Inventory != "" {
+			args = append(args, fmt.Sprintf("-i=%v", config.Inventory))
+		}
+
+		// Add verbose if configured
+		if config.Verbose {
+			args = append(args, "-vvvv")
+		}
+
+		_, err = DockerExec(args, !config.Quiet)
+	} else {
+		args := []string{
+			hostFilePath(config, config.PrepareFile),
+			"-i",
+			dist.CID + ",",
+			"-c",
+			"docker",
+		}
+
+		// Add verbose if configured
+		if config.Verbose {
+			args = append(args, "-vvvv")
+		}
+
+		_, err = AnsiblePlaybook(args, !config.Quiet)
+	}
+
+	if err != nil {
+		log.Errorln(err)
+		return false
+	}
+
+	return true
+}
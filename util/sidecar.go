@@ -0,0 +1,266 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ParentLabel is the label applied to containers and networks which
+// belong to a container under test, so they can be removed with it.
+const ParentLabel = "ansible-role-tester.parent"
+
+// SidecarTimeout is the default time to wait for a sidecar to become healthy.
+const SidecarTimeout = 2 * time.Minute
+
+// Sidecar is a service container, such as a database, which is started
+// on the same network as the container under test before it is started.
+type Sidecar struct {
+
+	// Name is the hostname the sidecar is reachable by from the container.
+	Name string `yaml:"name"`
+
+	// Image is the image reference of the sidecar.
+	Image string `yaml:"image"`
+
+	// Command is an optional command overriding the image default.
+	Command []string `yaml:"command"`
+
+	// Env is the environment of the sidecar.
+	Env map[string]string `yaml:"env"`
+
+	// Ports are published ports in the form accepted by 'docker run --publish'.
+	Ports []string `yaml:"ports"`
+
+	// Healthcheck overrides the healthcheck of the image.
+	Healthcheck struct {
+		Test     string `yaml:"test"`
+		Interval string `yaml:"interval"`
+		Timeout  string `yaml:"timeout"`
+		Retries  int    `yaml:"retries"`
+	} `yaml:"healthcheck"`
+
+	// Wait is the maximum time to wait for the sidecar to become
+	// healthy, ie 30s. It defaults to SidecarTimeout.
+	Wait string `yaml:"wait"`
+}
+
+// LoadSidecars will read and validate a sidecars file, for example:
+//
+//	sidecars:
+//	  - name: mysql
+//	    image: mysql:5.7
+//	    env:
+//	      MYSQL_ROOT_PASSWORD: secret
+//	    healthcheck:
+//	      test: mysqladmin ping -h localhost
+//	      interval: 5s
+//	      retries: 10
+func LoadSidecars(path string) ([]Sidecar, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := struct {
+		Sidecars []Sidecar `yaml:"sidecars"`
+	}{}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse sidecars %v: %v", path, err)
+	}
+
+	names := map[string]bool{}
+	for _, sidecar := range file.Sidecars {
+		if !imageComponentRegexp.MatchString(sidecar.Name) {
+			return nil, fmt.Errorf("invalid sidecar name '%v' in %v", sidecar.Name, path)
+		}
+		if names[sidecar.Name] {
+			return nil, fmt.Errorf("sidecar name '%v' is declared more than once in %v", sidecar.Name, path)
+		}
+		names[sidecar.Name] = true
+		if _, err := ParseImageReference(sidecar.Image); err != nil {
+			return nil, fmt.Errorf("sidecar %v: %v", sidecar.Name, err)
+		}
+		if sidecar.Wait != "" {
+			if _, err := time.ParseDuration(sidecar.Wait); err != nil {
+				return nil, fmt.Errorf("sidecar %v: invalid wait '%v'", sidecar.Name, sidecar.Wait)
+			}
+		}
+	}
+
+	return file.Sidecars, nil
+}
+
+// sidecarArgs returns the arguments for 'docker run' to start the sidecar.
+func (dist *Distribution) sidecarArgs(sidecar Sidecar, network string) []string {
+
+	args := []string{
+		"run",
+		"--detach",
+		fmt.Sprintf("--name=%v-%v", dist.CID, sidecar.Name),
+		fmt.Sprintf("--label=%v=%v", ParentLabel, dist.CID),
+		fmt.Sprintf("--hostname=%v", sidecar.Name),
+		fmt.Sprintf("--network=%v", network),
+		fmt.Sprintf("--network-alias=%v", sidecar.Name),
+	}
+
+	// Sort the environment so the arguments are predictable.
+	keys := []string{}
+	for key := range sidecar.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("--env=%v=%v", key, sidecar.Env[key]))
+	}
+
+	for _, port := range sidecar.Ports {
+		args = append(args, fmt.Sprintf("--publish=%v", port))
+	}
+
+	if sidecar.Healthcheck.Test != "" {
+		args = append(args, fmt.Sprintf("--health-cmd=%v", sidecar.Healthcheck.Test))
+	}
+	if sidecar.Healthcheck.Interval != "" {
+		args = append(args, fmt.Sprintf("--health-interval=%v", sidecar.Healthcheck.Interval))
+	}
+	if sidecar.Healthcheck.Timeout != "" {
+		args = append(args, fmt.Sprintf("--health-timeout=%v", sidecar.Healthcheck.Timeout))
+	}
+	if sidecar.Healthcheck.Retries > 0 {
+		args = append(args, fmt.Sprintf("--health-retries=%v", sidecar.Healthcheck.Retries))
+	}
+
+	args = append(args, sidecar.Image)
+	return append(args, sidecar.Command...)
+}
+
+// sidecarWait will wait for the sidecar container to become healthy, or
+// running if it has no healthcheck, returning an error on timeout.
+func sidecarWait(name string, timeout time.Duration) error {
+
+	deadline := time.Now().Add(timeout)
+	for {
+		out, err := DockerExec([]string{
+			"inspect",
+			"--format",
+			"{{.State.Status}} {{if .State.Health}}{{.State.Health.Status}}{{else}}none{{end}}",
+			name,
+		}, false)
+
+		if err == nil {
+			state := strings.Fields(strings.TrimSpace(out))
+			if len(state) == 2 {
+				if state[0] == "exited" || state[0] == "dead" || state[1] == "unhealthy" {
+					return fmt.Errorf("sidecar %v is %v", name, strings.Join(state, " and "))
+				}
+				if state[0] == "running" && (state[1] == "healthy" || state[1] == "none") {
+					return nil
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("sidecar %v did not become healthy within %v", name, timeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// SidecarsRun will start the sidecars on the network of the configuration,
+// creating a network for the container if none is configured, and wait for
+// each of them to become healthy. Sidecars and the network are labelled
+// with the container name so they are removed by DockerKill. Sidecar
+// images are pulled according to the pull policy, see DockerPullPolicy.
+func (dist *Distribution) SidecarsRun(config *AnsibleConfig, report *AnsibleReport, sidecars []Sidecar, policy string) error {
+
+	if len(sidecars) == 0 {
+		return nil
+	}
+
+	if dist.CID == "" {
+		dist.CID = fmt.Sprint(time.Now().Unix())
+	}
+
+	if config.Network == NetworkNone {
+		return errors.New("sidecars cannot be used with network mode none")
+	}
+
+	if config.Network == "" {
+		config.Network = fmt.Sprintf("%v-network", dist.CID)
+		if err := DockerNetworkCreate(config.Network, false, []string{fmt.Sprintf("%v=%v", ParentLabel, dist.CID)}, config.Quiet); err != nil {
+			return err
+		}
+	}
+
+	for _, sidecar := range sidecars {
+		if err := DockerPullPolicy(sidecar.Image, policy, config.Quiet); err != nil {
+			return err
+		}
+		if !config.Quiet {
+			log.Printf("Running sidecar %v (%v)", sidecar.Name, sidecar.Image)
+		}
+		if _, err := DockerExec(dist.sidecarArgs(sidecar, config.Network), false); err != nil {
+			return fmt.Errorf("could not start sidecar %v: %v", sidecar.Name, err)
+		}
+		report.Docker.Sidecars = append(report.Docker.Sidecars, sidecar.Name)
+	}
+
+	for _, sidecar := range sidecars {
+		timeout := SidecarTimeout
+		if sidecar.Wait != "" {
+			timeout, _ = time.ParseDuration(sidecar.Wait)
+		}
+		if !config.Quiet {
+			log.Printf("Waiting for sidecar %v to become healthy", sidecar.Name)
+		}
+		if err := sidecarWait(fmt.Sprintf("%v-%v", dist.CID, sidecar.Name), timeout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sidecarsKill will remove all of the containers and networks
+// which have been labelled as belonging to the container.
+func (dist *Distribution) sidecarsKill(quiet bool) {
+
+	filter := fmt.Sprintf("label=%v=%v", ParentLabel, dist.CID)
+
+	out, err := DockerExec([]string{
+		"ps",
+		"--all",
+		"--quiet",
+		"--filter",
+		filter,
+	}, false)
+	if err == nil && strings.TrimSpace(out) != "" {
+		if !quiet {
+			log.Printf("Removing sidecars of %v\n", dist.CID)
+		}
+		if _, err := DockerExec(append([]string{"rm", "--force", "--volumes"}, strings.Fields(out)...), false); err != nil {
+			log.Errorln(err)
+		}
+	}
+
+	out, err = DockerExec([]string{
+		"network",
+		"ls",
+		"--quiet",
+		"--filter",
+		filter,
+	}, false)
+	if err == nil && strings.TrimSpace(out) != "" {
+		if _, err := DockerExec(append([]string{"network", "rm"}, strings.Fields(out)...), false); err != nil {
+			log.Errorln(err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSidecarsRunPull(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	fake := &FakeExecutor{Respond: func(command Command) (CommandResult, error) {
+		if len(command.Args) > 0 && command.Args[0] == "inspect" {
+			return CommandResult{Stdout: "running none\n"}, nil
+		}
+		return CommandResult{}, nil
+	}}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	dist := Ubuntu1804
+	dist.CID = "art-test"
+	config := AnsibleConfig{Network: "art-test-network", Quiet: true}
+	sidecars := []Sidecar{{Name: "mysql", Image: "mysql:5.7"}}
+
+	if err := dist.SidecarsRun(&config, &AnsibleReport{}, sidecars, PullAlways); err != nil {
+		t.Fatalf("SidecarsRun() error = %v", err)
+	}
+
+	commands := []string{}
+	for _, command := range fake.Commands {
+		if len(command.Args) > 0 && (command.Args[0] == "pull" || command.Args[0] == "run") {
+			commands = append(commands, command.Args[0]+" "+command.Args[len(command.Args)-1])
+		}
+	}
+	want := []string{"pull mysql:5.7", "run mysql:5.7"}
+	if strings.Join(commands, ",") != strings.Join(want, ",") {
+		t.Errorf("commands = %v, want %v", commands, want)
+	}
+}
@@ -0,0 +1,248 @@
+package util
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SnapshotRepository is the local repository used to tag snapshots
+// of containers taken after requirements and prepare have run.
+const SnapshotRepository = "ansible-role-tester/snapshot"
+
+// SnapshotLabel is the label identifying the role and distribution
+// a snapshot was taken for, so superseded snapshots can be pruned.
+const SnapshotLabel = "ansible-role-tester.snapshot"
+
+// SnapshotPrepare will assign a snapshot tag to the configuration, which
+// is derived from a hash of every input affecting the container before it
+// is snapshotted: the image, the initialise command and volume, the extra
+// roles path, the requirements file and the prepare playbook along with the
+// files it includes or templates from its own directory. Files used by the
+// prepare playbook from roles are not part of the hash. This must be called
+// before the paths are mapped.
+func (dist *Distribution) SnapshotPrepare(config *AnsibleConfig) error {
+
+	hash := sha256.New()
+
+	// Resolve the image to its digest, so an updated tag invalidates the snapshot.
+	image := dist.Container
+	if digest, err := ImageDigest(dist.Container); err == nil {
+		image = digest
+	}
+	fmt.Fprintf(hash, "image=%v\ninitialise=%v\nvolume=%v\n", image, dist.Family.Initialise, dist.Family.Volume)
+
+	fmt.Fprintf(hash, "roles=%v\n", config.ExtraRolesPath)
+	if config.ExtraRolesPath != "" {
+		if err := hashTree(hash, config.ExtraRolesPath); err != nil {
+			return fmt.Errorf("could not read %v: %v", config.ExtraRolesPath, err)
+		}
+	}
+
+	files := []string{config.RequirementsFile, config.PrepareFile}
+	if config.PrepareFile != "" {
+		files = append(files, playbookFiles(hostFilePath(config, config.PrepareFile))...)
+	}
+	for _, file := range files {
+		fmt.Fprintf(hash, "file=%v\n", file)
+		if file == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(hostFilePath(config, file))
+		if err != nil {
+			return fmt.Errorf("could not read %v: %v", file, err)
+		}
+		io.WriteString(hash, string(data))
+	}
+
+	sum := fmt.Sprintf("%x", hash.Sum(nil))
+	config.Snapshot = fmt.Sprintf("%v:%v", SnapshotRepository, sum[:12])
+	return nil
+}
+
+// hashTree will write the path and contents of every regular file
+// in the directory to the hash, in the order Walk visits them.
+func hashTree(hash io.Writer, dir string) error {
+	return filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, file)
+		fmt.Fprintf(hash, "%v\x00%v\x00", filepath.ToSlash(rel), len(data))
+		hash.Write(data)
+		return nil
+	})
+}
+
+// playbookValue matches the value of a key or list item in a playbook.
+var playbookValue = regexp.MustCompile(`^\s*(?:-\s+)?(?:[\w.]+:\s+)?["']?([^"'\s{}]+)["']?\s*$`)
+
+// playbookFiles will return the files a playbook includes, imports or
+// templates which exist relative to it, or in its files and templates
+// folders, and the files those include in turn. Values which are not
+// files are ignored, so the result is sorted and free of duplicates.
+func playbookFiles(playbook string) []string {
+
+	found := map[string]bool{playbook: true}
+	queue := []string{playbook}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Dir(file)
+		for _, line := range strings.Split(string(data), "\n") {
+			match := playbookValue.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			for _, candidate := range []string{
+				filepath.Join(dir, match[1]),
+				filepath.Join(dir, "files", match[1]),
+				filepath.Join(dir, "templates", match[1]),
+			} {
+				info, err := os.Stat(candidate)
+				if err != nil || !info.Mode().IsRegular() || found[candidate] {
+					continue
+				}
+				found[candidate] = true
+				if ext := filepath.Ext(candidate); ext == ".yml" || ext == ".yaml" {
+					queue = append(queue, candidate)
+				}
+			}
+		}
+	}
+
+	delete(found, playbook)
+	files := []string{}
+	for file := range found {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// snapshotOwner will return the value of the SnapshotLabel for the
+// role and distribution of the configuration.
+func (dist *Distribution) snapshotOwner(config *AnsibleConfig) string {
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(config.HostPath+"\n"+dist.Name)))
+	return sum[:12]
+}
+
+// SnapshotRestore will use the snapshot of the configuration as the image
+// for the Distribution if it exists, returning true if it was found.
+func (dist *Distribution) SnapshotRestore(config *AnsibleConfig) bool {
+
+	if config.Snapshot == "" || !DockerImageExists(config.Snapshot) {
+		return false
+	}
+
+	if !config.Quiet {
+		log.Infof("Using snapshot %v of %v", config.Snapshot, dist.Container)
+	}
+
+	dist.Container = config.Snapshot
+	return true
+}
+
+// SnapshotCommit will snapshot the running container to the snapshot
+// of the configuration, so it can be reused by later runs. Snapshots
+// previously taken for the same role and distribution are superseded,
+// and are removed.
+func (dist *Distribution) SnapshotCommit(config *AnsibleConfig) bool {
+
+	if config.Snapshot == "" {
+		return false
+	}
+
+	if !config.Quiet {
+		log.Printf("Saving snapshot of %v as %v", dist.CID, config.Snapshot)
+	}
+
+	owner := dist.snapshotOwner(config)
+	if _, err := DockerExec([]string{
+		"commit",
+		fmt.Sprintf("--message=ansible-role-tester snapshot taken %v", time.Now().Format(time.RFC3339)),
+		fmt.Sprintf("--change=LABEL %v=%v", SnapshotLabel, owner),
+		dist.CID,
+		config.Snapshot,
+	}, false); err != nil {
+		log.Errorf("could not save snapshot: %v", err)
+		return false
+	}
+
+	snapshots, err := snapshotList(fmt.Sprintf("label=%v=%v", SnapshotLabel, owner))
+	if err != nil {
+		log.Warnf("could not list snapshots: %v", err)
+		return true
+	}
+	superseded := []string{}
+	for _, snapshot := range snapshots {
+		if snapshot != config.Snapshot {
+			superseded = append(superseded, snapshot)
+		}
+	}
+	if len(superseded) > 0 {
+		if _, err := DockerExec(append([]string{"rmi"}, superseded...), false); err != nil {
+			log.Warnf("could not remove superseded snapshots: %v", err)
+		}
+	}
+
+	return true
+}
+
+// snapshotList will return the snapshots matching the filter, sorted.
+func snapshotList(filter string) ([]string, error) {
+
+	out, err := DockerExec([]string{
+		"images",
+		"--filter",
+		filter,
+		"--format",
+		"{{.Repository}}:{{.Tag}}",
+		SnapshotRepository,
+	}, false)
+	if err != nil {
+		return []string{}, err
+	}
+
+	snapshots := strings.Fields(out)
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// SnapshotList will return every snapshot image, sorted.
+func SnapshotList() ([]string, error) {
+	return snapshotList("dangling=false")
+}
+
+// SnapshotClear will remove every snapshot image. Snapshots which are
+// in use by a container cannot be removed, and are named in the error.
+func SnapshotClear() error {
+
+	snapshots, err := SnapshotList()
+	if err != nil || len(snapshots) == 0 {
+		return err
+	}
+
+	_, err = DockerExec(append([]string{"rmi"}, snapshots...), false)
+	return err
+}
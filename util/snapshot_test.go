@@ -0,0 +1,181 @@
+package util
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSnapshotPrepare(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir, cleanup := roleDir(t)
+	defer cleanup()
+
+	executor := CommandExecutor
+	CommandExecutor = &FakeExecutor{}
+	defer func() { CommandExecutor = executor }()
+
+	write := func(path, content string) {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("tests/prepare.yml", "- hosts: all\n  tasks:\n    - include_tasks: tasks/users.yml\n")
+	write("tests/tasks/users.yml", "- template:\n    src: motd.j2\n    dest: /etc/motd\n")
+	write("tests/tasks/templates/motd.j2", "one")
+	write("tests/unrelated.yml", "one")
+	write("roles/dependency/tasks/main.yml", "one")
+
+	dist := Ubuntu1804
+	config := AnsibleConfig{HostPath: dir, PrepareFile: "tests/prepare.yml"}
+	snapshot := func() string {
+		c := config
+		d := dist
+		if err := d.SnapshotPrepare(&c); err != nil {
+			t.Fatal(err)
+		}
+		return c.Snapshot
+	}
+
+	first := snapshot()
+	if !strings.HasPrefix(first, SnapshotRepository+":") {
+		t.Errorf("snapshot %v is not in %v", first, SnapshotRepository)
+	}
+	if snapshot() != first {
+		t.Error("the snapshot changed without any changes")
+	}
+
+	write("tests/unrelated.yml", "two")
+	if snapshot() != first {
+		t.Error("the snapshot changed when a file the prepare playbook does not use changed")
+	}
+
+	tests := []struct {
+		name   string
+		change func()
+	}{
+		{"an included file changed", func() { write("tests/tasks/users.yml", "- template:\n    src: motd.j2\n    dest: /etc/issue\n") }},
+		{"a template changed", func() { write("tests/tasks/templates/motd.j2", "two") }},
+		{"the volume changed", func() { dist.Family.Volume = "/sys/fs/cgroup:/sys/fs/cgroup:rw" }},
+		{"the extra roles path was set", func() { config.ExtraRolesPath = filepath.Join(dir, "roles") }},
+		{"an extra role changed", func() { write("roles/dependency/tasks/main.yml", "two") }},
+	}
+	previous := first
+	for _, test := range tests {
+		test.change()
+		if got := snapshot(); got == previous {
+			t.Errorf("the snapshot did not change when %v", test.name)
+		} else {
+			previous = got
+		}
+	}
+
+	config.PrepareFile = "tests/missing.yml"
+	if err := dist.SnapshotPrepare(&config); err == nil {
+		t.Error("a missing prepare playbook was hashed")
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	tests := []struct {
+		name   string
+		images string
+		want   bool
+	}{
+		{"hit", "sha256:abc\n", true},
+		{"miss", "", false},
+	}
+
+	for _, test := range tests {
+		fake := &FakeExecutor{
+			Respond: func(command Command) (CommandResult, error) {
+				return CommandResult{Stdout: test.images}, nil
+			},
+		}
+		executor := CommandExecutor
+		CommandExecutor = fake
+
+		dist := Ubuntu1804
+		config := AnsibleConfig{Snapshot: SnapshotRepository + ":abc", Quiet: true}
+		got := dist.SnapshotRestore(&config)
+		CommandExecutor = executor
+
+		if got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+		want := Ubuntu1804.Container
+		if test.want {
+			want = config.Snapshot
+		}
+		if dist.Container != want {
+			t.Errorf("%v: got image %v, want %v", test.name, dist.Container, want)
+		}
+		if len(fake.Commands) != 1 || fake.Commands[0].String() != "docker images --quiet "+config.Snapshot {
+			t.Errorf("%v: got commands %v", test.name, fake.Commands)
+		}
+	}
+}
+
+func TestSnapshotCommit(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	tests := []struct {
+		name   string
+		fail   bool
+		want   bool
+		remove []string
+	}{
+		{"committed", false, true, []string{"rmi", SnapshotRepository + ":old"}},
+		{"failed", true, false, nil},
+	}
+
+	for _, test := range tests {
+		fake := &FakeExecutor{
+			Respond: func(command Command) (CommandResult, error) {
+				switch command.Args[0] {
+				case "commit":
+					if test.fail {
+						return CommandResult{ExitCode: 1}, errors.New("exit status 1")
+					}
+				case "images":
+					return CommandResult{Stdout: SnapshotRepository + ":new\n" + SnapshotRepository + ":old\n"}, nil
+				}
+				return CommandResult{}, nil
+			},
+		}
+		executor := CommandExecutor
+		CommandExecutor = fake
+
+		dist := Ubuntu1804
+		dist.CID = "art-test"
+		config := AnsibleConfig{HostPath: "/home/user/ansible-role-example", Snapshot: SnapshotRepository + ":new", Quiet: true}
+		got := dist.SnapshotCommit(&config)
+		CommandExecutor = executor
+
+		if got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+		commit := fake.Commands[0].Args
+		if commit[0] != "commit" || !contains(commit, "--change=LABEL "+SnapshotLabel+"="+dist.snapshotOwner(&config)) || !reflect.DeepEqual(commit[len(commit)-2:], []string{"art-test", config.Snapshot}) {
+			t.Errorf("%v: got commit %v", test.name, commit)
+		}
+		var removed []string
+		for _, command := range fake.Commands {
+			if command.Args[0] == "rmi" {
+				removed = command.Args
+			}
+		}
+		if !reflect.DeepEqual(removed, test.remove) {
+			t.Errorf("%v: got %v, want %v", test.name, removed, test.remove)
+		}
+	}
+}
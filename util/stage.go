@@ -0,0 +1,275 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// StageRequirements installs the requirements file.
+	StageRequirements = "requirements"
+
+	// StagePrepare runs the prepare playbook.
+	StagePrepare = "prepare"
+
+	// StageSyntax checks the syntax of the playbook.
+	StageSyntax = "syntax"
+
+	// StageConverge runs the playbook.
+	StageConverge = "converge"
+
+	// StageIdempotence runs the playbook again to test idempotence.
+	StageIdempotence = "idempotence"
+
+	// StageFile is the file in the container recording
+	// the last stage which completed successfully.
+	StageFile = "/var/lib/ansible-role-tester/stage"
+)
+
+// Stages is every stage of a test, in the order they run.
+var Stages = []string{
+	StageRequirements,
+	StagePrepare,
+	StageSyntax,
+	StageConverge,
+	StageIdempotence,
+}
+
+// RoleStageNames is the stages which test the role, in the order they run.
+var RoleStageNames = []string{
+	StageSyntax,
+	StageConverge,
+	StageIdempotence,
+}
+
+// ErrNoStages is returned when the stages and the stage to start from
+// leave no stages to run.
+var ErrNoStages = errors.New("no stages are selected to run")
+
+// stageIndex will return the position of the stage in Stages, or -1.
+func stageIndex(stage string) int {
+	for i, s := range Stages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+// StageNext will return the stage after the input stage, the first
+// stage when the input is empty, or an empty string after the last.
+func StageNext(stage string) string {
+	i := stageIndex(stage)
+	if stage != "" && i < 0 {
+		return Stages[0]
+	}
+	if i+1 < len(Stages) {
+		return Stages[i+1]
+	}
+	return ""
+}
+
+// StagePrevious will return the stage before the input stage,
+// or an empty string for the first stage.
+func StagePrevious(stage string) string {
+	if i := stageIndex(stage); i > 0 {
+		return Stages[i-1]
+	}
+	return ""
+}
+
+// SelectStages will return the stages which should run. All stages
+// are selected when names is empty, and stages before from are not.
+func SelectStages(names []string, from string) (map[string]bool, error) {
+	return SelectStagesOf(Stages, names, from)
+}
+
+// SelectStagesOf will return the stages which should run from the stages
+// a command can run. All of them are selected when names is empty, and
+// stages before from are not. Stages the command cannot run are rejected,
+// and ErrNoStages is returned when no stage is left to run.
+func SelectStagesOf(stages []string, names []string, from string) (map[string]bool, error) {
+
+	available := map[string]bool{}
+	for _, stage := range stages {
+		available[stage] = true
+	}
+
+	selected := map[string]bool{}
+	if len(names) == 0 {
+		names = stages
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if stageIndex(name) < 0 {
+			return selected, fmt.Errorf("unknown stage %v, expected one of %v", name, strings.Join(stages, ", "))
+		}
+		if !available[name] {
+			return selected, fmt.Errorf("stage %v cannot be run by this command, expected one of %v", name, strings.Join(stages, ", "))
+		}
+		selected[name] = true
+	}
+
+	if from != "" {
+		start := stageIndex(from)
+		if start < 0 {
+			return selected, fmt.Errorf("unknown stage %v, expected one of %v", from, strings.Join(Stages, ", "))
+		}
+		for _, stage := range Stages[:start] {
+			delete(selected, stage)
+		}
+	}
+
+	if len(selected) == 0 {
+		return selected, ErrNoStages
+	}
+	return selected, nil
+}
+
+// ResumeStages will return the stages which should run after the last
+// stage which completed, in the same way as SelectStagesOf. No stages
+// are returned when every selected stage has already completed.
+func ResumeStages(stages []string, names []string, completed string) (map[string]bool, error) {
+
+	if completed == Stages[len(Stages)-1] {
+		return map[string]bool{}, nil
+	}
+
+	selected, err := SelectStagesOf(stages, names, StageNext(completed))
+	if err == ErrNoStages {
+		return selected, nil
+	}
+	return selected, err
+}
+
+// StageRecord will record the stage as the last completed
+// stage on the container, clearing it if the stage is empty.
+func (dist *Distribution) StageRecord(stage string) error {
+	_, err := DockerExec([]string{
+		"exec",
+		dist.CID,
+		"sh",
+		"-c",
+		fmt.Sprintf("mkdir -p $(dirname %[1]v) && echo '%[2]v' > %[1]v", StageFile, stage),
+	}, false)
+	return err
+}
+
+// StageCompleted will return the last stage which completed on the
+// container, or an empty string if no stage has been recorded.
+func (dist *Distribution) StageCompleted() string {
+	out, err := DockerExec([]string{
+		"exec",
+		dist.CID,
+		"cat",
+		StageFile,
+	}, false)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// Skip will mark the stage as skipped in the report. The result of
+// the stage is left as it is, so a skipped stage is never reported as
+// passed, but RunStage still continues to the following stages.
+func (report *AnsibleReport) Skip(stage string) {
+	report.Ansible.Skipped = append(report.Ansible.Skipped, stage)
+	now := time.Now()
+	report.Stages = append(report.Stages, StageResult{
+		Name:    stage,
+		Start:   now,
+		End:     now,
+		Skipped: true,
+	})
+	notifyStage(report, report.Stages[len(report.Stages)-1])
+}
+
+// StageSkipped will identify if the stage was skipped in the report.
+func (report *AnsibleReport) StageSkipped(stage string) bool {
+	for _, skipped := range report.Ansible.Skipped {
+		if skipped == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// RunStage will run the stage when it is selected, recording it on the
+// container if it passes, and return the result. Unselected stages are
+// skipped, and true is returned so that the following stages run.
+func (dist *Distribution) RunStage(stage string, selected map[string]bool, report *AnsibleReport, run func() bool) bool {
+
+	if !selected[stage] {
+		report.Skip(stage)
+		return true
+	}
+
+	report.StageBegin(stage)
+	result := run()
+	report.StageEnd(result)
+
+	recorded := stage
+	if !result {
+		recorded = StagePrevious(stage)
+	}
+	if err := dist.StageRecord(recorded); err != nil {
+		log.Warnf("Could not record stage %v on %v: %v", stage, dist.CID, err)
+	}
+
+	return result
+}
+
+// RoleStage will run the syntax, converge or idempotence stage when it
+// is selected, returning the result of the stage.
+func (dist *Distribution) RoleStage(stage string, config *AnsibleConfig, report *AnsibleReport, selected map[string]bool) bool {
+
+	switch stage {
+	case StageSyntax:
+		return dist.RunStage(StageSyntax, selected, report, func() bool {
+			if config.Remote {
+				report.Ansible.Syntax = dist.RoleSyntaxCheckRemote(config)
+			} else {
+				report.Ansible.Syntax = dist.RoleSyntaxCheck(config)
+			}
+			return report.Ansible.Syntax
+		})
+	case StageConverge:
+		return dist.RunStage(StageConverge, selected, report, func() bool {
+			if config.Remote {
+				report.Ansible.Run.Result, report.Ansible.Run.Time = dist.RoleTestRemote(config)
+			} else {
+				report.Ansible.Run.Result, report.Ansible.Run.Time = dist.RoleTest(config)
+			}
+			return report.Ansible.Run.Result
+		})
+	case StageIdempotence:
+		return dist.RunStage(StageIdempotence, selected, report, func() bool {
+			if config.Remote {
+				report.Ansible.Idempotence.Result, report.Ansible.Idempotence.Time, report.Ansible.Idempotence.Changed = dist.IdempotenceTestRemote(config)
+			} else {
+				report.Ansible.Idempotence.Result, report.Ansible.Idempotence.Time, report.Ansible.Idempotence.Changed = dist.IdempotenceTest(config)
+			}
+			return report.Ansible.Idempotence.Result
+		})
+	}
+
+	return false
+}
+
+// RoleStages will run the syntax, converge and idempotence stages
+// which are selected, stopping at the first which fails.
+func (dist *Distribution) RoleStages(config *AnsibleConfig, report *AnsibleReport, selected map[string]bool) {
+	for _, stage := range RoleStageNames {
+		if !dist.RoleStage(stage, config, report, selected) {
+			return
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package util
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestStageNext(t *testing.T) {
+	tests := []struct {
+		stage string
+		want  string
+	}{
+		{"", StageRequirements},
+		{StageRequirements, StagePrepare},
+		{StageConverge, StageIdempotence},
+		{StageIdempotence, ""},
+		{"unknown", StageRequirements},
+	}
+
+	for _, test := range tests {
+		if got := StageNext(test.stage); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.stage, got, test.want)
+		}
+	}
+}
+
+func TestStagePrevious(t *testing.T) {
+	tests := []struct {
+		stage string
+		want  string
+	}{
+		{"", ""},
+		{StageRequirements, ""},
+		{StagePrepare, StageRequirements},
+		{StageIdempotence, StageConverge},
+		{"unknown", ""},
+	}
+
+	for _, test := range tests {
+		if got := StagePrevious(test.stage); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.stage, got, test.want)
+		}
+	}
+}
+
+func TestSelectStages(t *testing.T) {
+	// stages returns the selection of the named stages.
+	stages := func(names ...string) map[string]bool {
+		selected := map[string]bool{}
+		for _, name := range names {
+			selected[name] = true
+		}
+		return selected
+	}
+
+	tests := []struct {
+		name      string
+		stages    []string
+		names     []string
+		from      string
+		resume    bool
+		completed string
+		want      map[string]bool
+		err       string
+	}{
+		{"all stages", Stages, nil, "", false, "", stages(Stages...), ""},
+		{"all stages of a command", RoleStageNames, nil, "", false, "", stages(RoleStageNames...), ""},
+		{"named stages", Stages, []string{"syntax", " converge"}, "", false, "", stages(StageSyntax, StageConverge), ""},
+		{"unknown stage", Stages, []string{"lint"}, "", false, "", nil, "unknown stage lint"},
+		{"stage a command cannot run", RoleStageNames, []string{"requirements"}, "", false, "", nil, "stage requirements cannot be run by this command"},
+		{"from a stage", Stages, nil, StageConverge, false, "", stages(StageConverge, StageIdempotence), ""},
+		{"from a stage before those of a command", RoleStageNames, nil, StagePrepare, false, "", stages(RoleStageNames...), ""},
+		{"from an unknown stage", Stages, nil, "lint", false, "", nil, "unknown stage lint"},
+		{"from a stage after the last selected", Stages, []string{"syntax"}, StageConverge, false, "", nil, ErrNoStages.Error()},
+		{"empty selection", RoleStageNames, []string{" ", ""}, "", false, "", nil, ErrNoStages.Error()},
+		{"resume without a completed stage", Stages, nil, "", true, "", stages(Stages...), ""},
+		{"resume after a stage", Stages, nil, "", true, StageSyntax, stages(StageConverge, StageIdempotence), ""},
+		{"resume after the last stage", Stages, nil, "", true, StageIdempotence, stages(), ""},
+		{"resume after the last selected stage", Stages, []string{"syntax"}, "", true, StageConverge, stages(), ""},
+		{"resume with a stage a command cannot run", RoleStageNames, []string{"prepare"}, "", true, "", nil, "stage prepare cannot be run by this command"},
+	}
+
+	for _, test := range tests {
+		var got map[string]bool
+		var err error
+		if test.resume {
+			got, err = ResumeStages(test.stages, test.names, test.completed)
+		} else {
+			got, err = SelectStagesOf(test.stages, test.names, test.from)
+		}
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v: got error %v, want %v", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRunStage(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	tests := []struct {
+		name     string
+		selected bool
+		result   bool
+		want     bool
+		recorded string
+	}{
+		{"passed", true, true, true, StageConverge},
+		{"failed", true, false, false, StageSyntax},
+		{"skipped", false, false, true, ""},
+	}
+
+	for _, test := range tests {
+		fake := &FakeExecutor{}
+		executor := CommandExecutor
+		CommandExecutor = fake
+
+		dist := Ubuntu1804
+		dist.CID = "art-test"
+		report := AnsibleReport{}
+		ran := false
+		got := dist.RunStage(StageConverge, map[string]bool{StageConverge: test.selected}, &report, func() bool {
+			ran = true
+			return test.result
+		})
+		CommandExecutor = executor
+
+		if got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+		if ran != test.selected {
+			t.Errorf("%v: the stage ran %v, want %v", test.name, ran, test.selected)
+		}
+		if len(report.Stages) != 1 || report.Stages[0].Name != StageConverge || report.Stages[0].Skipped == test.selected || report.Stages[0].Result != test.result {
+			t.Errorf("%v: got stages %+v", test.name, report.Stages)
+		}
+		if report.StageSkipped(StageConverge) == test.selected {
+			t.Errorf("%v: skipped %v, want %v", test.name, report.StageSkipped(StageConverge), !test.selected)
+		}
+
+		if !test.selected {
+			if len(fake.Commands) != 0 {
+				t.Errorf("%v: a skipped stage was recorded: %v", test.name, fake.Commands)
+			}
+			continue
+		}
+		if len(fake.Commands) != 1 || !strings.Contains(fake.Commands[0].Args[len(fake.Commands[0].Args)-1], "echo '"+test.recorded+"' > "+StageFile) {
+			t.Errorf("%v: got commands %v, want %v recorded", test.name, fake.Commands, test.recorded)
+		}
+	}
+}
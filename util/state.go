@@ -0,0 +1,83 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// StateVersion is the version of the format the state of containers is
+// persisted in, which is increased when the report changes so that state
+// from an older version is not loaded.
+const StateVersion = 1
+
+// state is the file the report of a container is persisted in.
+type state struct {
+	Version int           `json:"version"`
+	Report  AnsibleReport `json:"report"`
+}
+
+// StateRoot will return the default directory for the state of
+// containers, which is shared by the run, install, test and
+// destroy commands so their results form a single report.
+func StateRoot() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "ansible-role-tester")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "state", "ansible-role-tester")
+}
+
+// statePath will return the path of the state file for the container.
+func statePath(root, name string) string {
+	return filepath.Join(root, name+".json")
+}
+
+// LoadState will return the report persisted for the container,
+// and false if no state has been persisted for it. An error is
+// returned for state persisted in a different StateVersion.
+func LoadState(root, name string) (AnsibleReport, bool, error) {
+
+	saved := state{}
+
+	data, err := ioutil.ReadFile(statePath(root, name))
+	if os.IsNotExist(err) {
+		return saved.Report, false, nil
+	} else if err != nil {
+		return saved.Report, false, err
+	}
+
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return AnsibleReport{}, false, err
+	}
+	if saved.Version != StateVersion {
+		return AnsibleReport{}, false, fmt.Errorf("state is version %v, expected %v", saved.Version, StateVersion)
+	}
+
+	return saved.Report, true, nil
+}
+
+// SaveState will persist the report for the container.
+func SaveState(root, name string, report *AnsibleReport) error {
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state{Version: StateVersion, Report: *report}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(statePath(root, name), data, 0644)
+}
+
+// RemoveState will remove the state persisted for the container.
+func RemoveState(root, name string) error {
+	if err := os.Remove(statePath(root, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, found, err := LoadState(dir, "art-test"); found || err != nil {
+		t.Errorf("LoadState() = %v, %v for a container without state", found, err)
+	}
+
+	report := AnsibleReport{}
+	report.Docker.Run = true
+	if err := SaveState(dir, "art-test", &report); err != nil {
+		t.Fatal(err)
+	}
+	loaded, found, err := LoadState(dir, "art-test")
+	if !found || err != nil {
+		t.Fatalf("LoadState() = %v, %v for a container with state", found, err)
+	}
+	if !loaded.Docker.Run {
+		t.Error("the report was not loaded from the state")
+	}
+
+	// State from before it was versioned is the report alone.
+	if err := ioutil.WriteFile(statePath(dir, "art-test"), []byte(`{"docker":{"run":true}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := LoadState(dir, "art-test"); found || err == nil {
+		t.Errorf("LoadState() = %v, %v for state of an older version", found, err)
+	}
+}
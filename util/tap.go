@@ -0,0 +1,132 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// StageListener is notified of the result of each stage as it completes.
+type StageListener interface {
+	StageCompleted(report *AnsibleReport, stage StageResult)
+}
+
+// Listener is notified of each stage as it completes, when it is set.
+var Listener StageListener
+
+// notifyStage will notify the Listener of the stage, if there is one.
+func notifyStage(report *AnsibleReport, stage StageResult) {
+	if Listener != nil {
+		Listener.StageCompleted(report, stage)
+	}
+}
+
+// TAPWriter is a StageListener which writes the result of each stage in
+// the Test Anything Protocol as it completes. Failed stages are followed
+// by a YAML diagnostics block, and the plan is written by End unless
+// testing was bailed out of.
+type TAPWriter struct {
+	Writer io.Writer
+
+	count  int
+	bailed bool
+	mu     sync.Mutex
+}
+
+// NewTAPWriter will return a TAPWriter which writes to the writer,
+// having written the version of the protocol.
+func NewTAPWriter(writer io.Writer) *TAPWriter {
+	fmt.Fprintln(writer, "TAP version 13")
+	return &TAPWriter{Writer: writer}
+}
+
+// tapName will return the name of the distribution the report is for.
+func tapName(report *AnsibleReport) string {
+	if len(report.Ansible.Instances) > 0 {
+		names := []string{}
+		for _, instance := range report.Ansible.Instances {
+			names = append(names, instance.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	if report.Ansible.Distribution.Name != "" {
+		return report.Ansible.Distribution.Name
+	}
+	return report.Ansible.Distribution.CID
+}
+
+// StageCompleted will write a test point for the stage.
+func (t *TAPWriter) StageCompleted(report *AnsibleReport, stage StageResult) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.count++
+	description := fmt.Sprintf("%v: %v", tapName(report), stage.Name)
+
+	switch {
+	case stage.Skipped:
+		fmt.Fprintf(t.Writer, "ok %v - %v # SKIP not selected\n", t.count, description)
+	case stage.Result:
+		fmt.Fprintf(t.Writer, "ok %v - %v\n", t.count, description)
+	default:
+		fmt.Fprintf(t.Writer, "not ok %v - %v\n", t.count, description)
+		t.diagnostics(report, stage)
+	}
+}
+
+// diagnostics will write the details of a failed stage as a YAML block.
+func (t *TAPWriter) diagnostics(report *AnsibleReport, stage StageResult) {
+
+	details := yaml.MapSlice{
+		{Key: "message", Value: fmt.Sprintf("%v failed", stage.Name)},
+		{Key: "severity", Value: "fail"},
+		{Key: "container", Value: report.Ansible.Distribution.CID},
+		{Key: "duration", Value: stage.Duration.String()},
+		{Key: "exit_code", Value: stage.ExitCode},
+	}
+	if stage.failedCommand != "" {
+		details = append(details, yaml.MapItem{Key: "command", Value: stage.failedCommand})
+	}
+	if stage.Output != "" {
+		details = append(details, yaml.MapItem{Key: "output", Value: stage.Output})
+	}
+	if tasks := PlaybookFailures(stage.FailureOutput()); len(tasks) > 0 {
+		details = append(details, yaml.MapItem{Key: "failed_tasks", Value: tasks})
+	}
+	if stage.Name == StageIdempotence && len(report.Ansible.Idempotence.Changed) > 0 {
+		details = append(details, yaml.MapItem{Key: "changed_tasks", Value: report.Ansible.Idempotence.Changed})
+	}
+
+	data, err := yaml.Marshal(details)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(t.Writer, "  ---")
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		fmt.Fprintf(t.Writer, "  %v\n", line)
+	}
+	fmt.Fprintln(t.Writer, "  ...")
+}
+
+// BailOut will write that testing could not continue because of the error.
+func (t *TAPWriter) BailOut(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.Writer, "Bail out! %v\n", err)
+	t.bailed = true
+}
+
+// End will write the plan, which is the number of test points
+// written, unless testing was bailed out of.
+func (t *TAPWriter) End() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bailed {
+		return
+	}
+	fmt.Fprintf(t.Writer, "1..%v\n", t.count)
+}
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTAPWriter(t *testing.T) {
+	output, remove := writeStageOutput(t, "TASK [example : Install packages] ***\nfatal: [art-test]: FAILED! => {}\n")
+	defer remove()
+
+	var out bytes.Buffer
+	tap := NewTAPWriter(&out)
+	listener := Listener
+	Listener = tap
+	defer func() { Listener = listener }()
+
+	report := AnsibleReport{}
+	report.Ansible.Distribution = Ubuntu1804
+	report.Ansible.Distribution.CID = "art-test"
+
+	report.StageBegin(StageStart)
+	report.StageEnd(true)
+	report.Skip(StageRequirements)
+	report.Stages = append(report.Stages, StageResult{Name: StageConverge, Duration: 1500 * time.Millisecond, ExitCode: 2, Output: output})
+	tap.StageCompleted(&report, report.Stages[len(report.Stages)-1])
+	tap.BailOut(errors.New("container was removed"))
+	tap.End()
+
+	want := `TAP version 13
+ok 1 - ubuntu1804: start
+ok 2 - ubuntu1804: requirements # SKIP not selected
+not ok 3 - ubuntu1804: converge
+  ---
+  message: converge failed
+  severity: fail
+  container: art-test
+  duration: 1.5s
+  exit_code: 2
+  output: ` + output + `
+  failed_tasks:
+  - 'example : Install packages (art-test)'
+  ...
+Bail out! container was removed
+`
+	if out.String() != want {
+		t.Errorf("got:\n%v\nwant:\n%v", out.String(), want)
+	}
+}
+
+func TestTAPWriterWithoutArtifacts(t *testing.T) {
+	fake := &FakeExecutor{
+		Respond: func(command Command) (CommandResult, error) {
+			return CommandResult{
+				Stdout:   "TASK [example : Install packages] ***\nfatal: [art-test]: FAILED! => {}\n",
+				ExitCode: 2,
+			}, errors.New("exit status 2")
+		},
+	}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	var out bytes.Buffer
+	tap := NewTAPWriter(&out)
+	listener := Listener
+	Listener = tap
+	defer func() { Listener = listener }()
+
+	report := AnsibleReport{}
+	report.Ansible.Distribution = Ubuntu1804
+	report.Ansible.Distribution.CID = "art-test"
+
+	report.StageBegin(StageConverge)
+	execute(Command{Name: "docker", Args: []string{"exec", "art-test", "ansible-playbook", "playbook.yml"}})
+	report.StageEnd(false)
+	tap.End()
+
+	for _, want := range []string{
+		"not ok 1 - ubuntu1804: converge\n",
+		"  exit_code: 2\n",
+		"  command: docker exec art-test ansible-playbook playbook.yml\n",
+		"  - 'example : Install packages (art-test)'\n",
+		"1..1\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("TAP output does not contain %q:\n%v", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Instance is a named container in a Topology.
+type Instance struct {
+
+	// Name is the inventory hostname of the instance, which is
+	// also its hostname and alias on the topology network.
+	Name string `yaml:"name"`
+
+	// User and Distribution select a Distribution for the
+	// instance in the same way as --user and --distribution.
+	User         string `yaml:"user"`
+	Distribution string `yaml:"distribution"`
+
+	// Image selects a Distribution by image, and when the image is not
+	// a known Distribution it is used as a custom distribution with
+	// the Initialise and Volume fields.
+	Image      string `yaml:"image"`
+	Initialise string `yaml:"initialise"`
+	Volume     string `yaml:"volume"`
+
+	// Groups are the inventory groups the instance is a member of.
+	Groups []string `yaml:"groups"`
+}
+
+// Topology is a set of instances which are tested together on a
+// shared network, using a generated inventory. For example:
+//
+//	instances:
+//	  - name: node1
+//	    distribution: ubuntu1804
+//	    groups: [galera, primary]
+//	  - name: node2
+//	    distribution: centos7
+//	    groups: [galera]
+type Topology struct {
+
+	// Network is the name of the network shared by all instances,
+	// which defaults to the container name prefix of the instances.
+	Network string `yaml:"network"`
+
+	// Instances is the list of instances in the topology.
+	Instances []Instance `yaml:"instances"`
+
+	// Distributions are the resolved distributions of each instance, in order.
+	Distributions []Distribution `yaml:"-"`
+
+	// rolesPath is a temporary roles path for Ansible on the host.
+	rolesPath string
+}
+
+// LoadTopology will read and validate a topology file.
+func LoadTopology(path string) (*Topology, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	topology := new(Topology)
+	if err := yaml.UnmarshalStrict(data, topology); err != nil {
+		return nil, fmt.Errorf("could not parse topology %v: %v", path, err)
+	}
+
+	if len(topology.Instances) == 0 {
+		return nil, fmt.Errorf("topology %v does not declare any instances", path)
+	}
+
+	names := map[string]bool{}
+	for _, instance := range topology.Instances {
+		if !imageComponentRegexp.MatchString(instance.Name) {
+			return nil, fmt.Errorf("invalid instance name '%v' in topology %v", instance.Name, path)
+		}
+		if names[instance.Name] {
+			return nil, fmt.Errorf("instance name '%v' is declared more than once in topology %v", instance.Name, path)
+		}
+		names[instance.Name] = true
+	}
+
+	return topology, nil
+}
+
+// Resolve will find the Distribution for each instance, which will be
+// started as a container named after the prefix and the instance name.
+func (t *Topology) Resolve(prefix string) error {
+
+	if t.Network == "" {
+		t.Network = prefix
+	}
+
+	t.Distributions = []Distribution{}
+	for _, instance := range t.Instances {
+
+		user := instance.User
+		if user == "" {
+			user = "fubarhouse"
+		}
+
+		dist, err := GetDistribution(instance.Image, instance.Image, "/sbin/init", "/sys/fs/cgroup:/sys/fs/cgroup:ro", user, instance.Distribution)
+		if err != nil {
+			if instance.Image == "" {
+				return fmt.Errorf("instance %v: %v", instance.Name, err)
+			}
+			ref, err := ParseImageReference(instance.Image)
+			if err != nil {
+				return fmt.Errorf("instance %v: %v", instance.Name, err)
+			}
+			dist = *NewCustomDistribution()
+			dist.Privileged = true
+			dist.Name = instance.Name
+			dist.Container = ref.String()
+			dist.User = ref.Namespace
+			dist.Distro = instance.Image
+			dist.Family.Initialise = instance.Initialise
+			dist.Family.Volume = instance.Volume
+			if dist.Family.Initialise == "" {
+				dist.Family.Initialise = "/bin/systemd"
+			}
+			if dist.Family.Volume == "" {
+				dist.Family.Volume = "/sys/fs/cgroup:/sys/fs/cgroup:ro"
+			}
+		}
+
+		dist.CID = fmt.Sprintf("%v-%v", prefix, instance.Name)
+		t.Distributions = append(t.Distributions, dist)
+	}
+
+	return nil
+}
+
+// Inventory will return an INI inventory for the topology, connecting
+// to each instance using the docker connection and declaring its groups.
+func (t *Topology) Inventory() string {
+
+	lines := []string{}
+	groups := map[string][]string{}
+	for i, instance := range t.Instances {
+		lines = append(lines, fmt.Sprintf("%v ansible_connection=docker ansible_host=%v", instance.Name, t.Distributions[i].CID))
+		for _, group := range instance.Groups {
+			groups[group] = append(groups[group], instance.Name)
+		}
+	}
+
+	names := []string{}
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	for _, group := range names {
+		lines = append(lines, "", fmt.Sprintf("[%v]", group))
+		lines = append(lines, groups[group]...)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Up will create the network and start a container for every instance,
+// returning true if all of the containers are running. A temporary
+// inventory and roles path for running Ansible on the host are prepared,
+// unless commands are only planned, and the path to the inventory is
+// returned.
+func (t *Topology) Up(config *AnsibleConfig, report *AnsibleReport) (string, bool) {
+
+	if len(t.Distributions) != len(t.Instances) {
+		log.Errorln("topology has not been resolved")
+		return "", false
+	}
+
+	inventory, err := t.prepareHost(config)
+	if err != nil {
+		log.Errorln(err)
+		return "", false
+	}
+
+	if err := DockerNetworkCreate(t.Network, config.NetworkMode == NetworkInternal, []string{}, config.Quiet); err != nil {
+		log.Errorln(err)
+		return inventory, false
+	}
+
+	running := true
+	for i := range t.Distributions {
+		instanceConfig := *config
+		instanceConfig.Network = t.Network
+		instanceConfig.Hostname = t.Instances[i].Name
+
+		// Each instance has its own volumes, which are
+		// merged into the report once it has started.
+		instanceReport := AnsibleReport{}
+		if !t.Distributions[i].DockerRun(&instanceConfig, &instanceReport) {
+			running = false
+		}
+		report.Docker.Volumes = uniqueStrings(append(report.Docker.Volumes, instanceReport.Docker.Volumes...))
+	}
+
+	report.Ansible.Instances = t.Distributions
+	return inventory, running
+}
+
+// prepareHost will create the temporary inventory and roles path,
+// returning the path to the inventory.
+func (t *Topology) prepareHost(config *AnsibleConfig) (string, error) {
+
+	if planning() {
+		t.rolesPath = filepath.Join(os.TempDir(), "ansible-role-tester-topology")
+		return filepath.Join(t.rolesPath, "inventory"), nil
+	}
+
+	dir, err := ioutil.TempDir("", "ansible-role-tester-topology")
+	if err != nil {
+		return "", err
+	}
+	t.rolesPath = dir
+
+	// Roles are symlinked so they can be referred to either
+	// by directory name or by the role_under_test convention.
+	for _, name := range []string{filepath.Base(config.HostPath), "role_under_test"} {
+		if err := os.Symlink(config.HostPath, filepath.Join(dir, name)); err != nil {
+			return "", err
+		}
+	}
+
+	inventory := filepath.Join(dir, "inventory")
+	if err := ioutil.WriteFile(inventory, []byte(t.Inventory()), 0644); err != nil {
+		return "", err
+	}
+
+	return inventory, nil
+}
+
+// Down will remove the container of every instance and the network,
+// returning true if none of the containers are running.
+func (t *Topology) Down(quiet bool) bool {
+
+	stopped := true
+	for i := range t.Distributions {
+		if t.Distributions[i].DockerCheck() {
+			t.Distributions[i].DockerKill(quiet)
+		}
+		if t.Distributions[i].DockerCheck() {
+			stopped = false
+		}
+	}
+
+	if err := DockerNetworkRemove(t.Network, quiet); err != nil {
+		log.Errorln(err)
+	}
+
+	if t.rolesPath != "" && !planning() {
+		os.RemoveAll(t.rolesPath)
+	}
+
+	return stopped
+}
+
+// env will return the environment for Ansible on the host.
+func (t *Topology) env(config *AnsibleConfig) []string {
+
+	roles := []string{t.rolesPath}
+	if config.ExtraRolesPath != "" {
+		roles = append(roles, config.ExtraRolesPath)
+	}
+
+	env := []string{fmt.Sprintf("ANSIBLE_ROLES_PATH=%v", strings.Join(roles, string(os.PathListSeparator)))}
+	if config.LibraryPath != "" {
+		env = append(env, fmt.Sprintf("ANSIBLE_LIBRARY=%v", config.LibraryPath))
+	}
+
+	return env
+}
+
+// playbookArgs will return the ansible-playbook arguments for the topology.
+func (t *Topology) playbookArgs(config *AnsibleConfig, inventory string) []string {
+
+	args := []string{
+		hostFilePath(config, config.PlaybookFile),
+		"-i",
+		inventory,
+	}
+
+	// Add verbose if configured
+	if config.Verbose {
+		args = append(args, "-vvvv")
+	}
+
+	return args
+}
+
+// RoleInstall will install the requirements on the host into
+// the roles path used for the topology, if configured.
+func (t *Topology) RoleInstall(config *AnsibleConfig) bool {
+
+	if config.RequirementsFile == "" {
+		if !config.Quiet {
+			log.Warnln("Requirements file is not configured (empty/null), skipping...")
+		}
+		return false
+	}
+
+	req := hostFilePath(config, config.RequirementsFile)
+	log.Printf("Installing requirements from %v\n", req)
+
+	if _, err := AnsibleGalaxyEnv([]string{
+		"install",
+		"-r",
+		req,
+		"--roles-path",
+		t.rolesPath,
+	}, t.env(config), !config.Quiet); err != nil {
+		log.Errorln(err)
+		return false
+	}
+
+	return true
+}
+
+// RolePrepare will run the prepare playbook, if configured, against the topology.
+func (t *Topology) RolePrepare(config *AnsibleConfig, inventory string) bool {
+
+	if config.PrepareFile == "" {
+		return true
+	}
+
+	if !config.Quiet {
+		log.Infoln("Preparing the instances...")
+	}
+
+	args := t.playbookArgs(config, inventory)
+	args[0] = hostFilePath(config, config.PrepareFile)
+	if _, err := AnsiblePlaybookEnv(args, t.env(config), !config.Quiet); err != nil {
+		log.Errorln(err)
+		return false
+	}
+
+	return true
+}
+
+// SyntaxCheck will run a syntax check of the playbook against the topology.
+func (t *Topology) SyntaxCheck(config *AnsibleConfig, inventory string) bool {
+
+	if !config.Quiet {
+		log.Infoln("Checking role syntax...")
+	}
+
+	args := append(t.playbookArgs(config, inventory), "--syntax-check")
+	if _, err := AnsiblePlaybookEnv(args, t.env(config), !config.Quiet); err != nil {
+		log.Errorln("Syntax check: FAIL")
+		return false
+	}
+
+	if !config.Quiet {
+		log.Infoln("Syntax check: PASS")
+	}
+	return true
+}
+
+// RoleTest will run the playbook once against the topology.
+func (t *Topology) RoleTest(config *AnsibleConfig, inventory string) (bool, time.Duration) {
+
+	if !config.Quiet {
+		log.Infoln("Running the role...")
+	}
+
+	now := time.Now()
+	if _, err := AnsiblePlaybookEnv(t.playbookArgs(config, inventory), t.env(config), !config.Quiet); err != nil {
+		log.Errorln(err)
+		return false, time.Since(now)
+	}
+
+	if !config.Quiet {
+		log.Infof("Role ran in %v", time.Since(now))
+	}
+	return true, time.Since(now)
+}
+
+// IdempotenceTest will run the playbook again against the topology and
+// check the output for any changed or failed tasks on any instance,
+// returning the tasks which changed.
+func (t *Topology) IdempotenceTest(config *AnsibleConfig, inventory string) (bool, time.Duration, []string) {
+
+	if !config.Quiet {
+		log.Infoln("Testing role idempotence...")
+	}
+
+	now := time.Now()
+	out, _ := AnsiblePlaybookEnv(t.playbookArgs(config, inventory), t.env(config), !config.Quiet)
+	idempotence := IdempotenceResult(out)
+
+	if !config.Quiet {
+		PrintIdempotenceResult(now, idempotence)
+	}
+
+	return idempotence, time.Since(now), IdempotenceChanges(out)
+}
+
+// Hosts will return the inventory hostnames of the topology.
+func (t *Topology) Hosts() []string {
+	hosts := []string{}
+	for _, instance := range t.Instances {
+		hosts = append(hosts, instance.Name)
+	}
+	return hosts
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestTopologyUpVolumes(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	fake := &FakeExecutor{}
+	executor := CommandExecutor
+	CommandExecutor = fake
+	defer func() { CommandExecutor = executor }()
+
+	topology := Topology{Instances: []Instance{
+		{Name: "web", Distribution: "ubuntu1804"},
+		{Name: "db", Distribution: "centos7"},
+	}}
+	if err := topology.Resolve("art-test"); err != nil {
+		t.Fatal(err)
+	}
+
+	config := AnsibleConfig{
+		HostPath:     "/home/user/ansible-role-example",
+		RemotePath:   "/etc/ansible/roles/role_under_test",
+		PackageCache: true,
+		Quiet:        true,
+	}
+	report := AnsibleReport{}
+	topology.Up(&config, &report)
+	defer topology.Down(true)
+
+	// Every instance mounts only its own volumes.
+	runs := [][]string{}
+	for _, command := range fake.Commands {
+		if len(command.Args) > 0 && command.Args[0] == "run" {
+			runs = append(runs, command.Args)
+		}
+	}
+	if len(runs) != 2 {
+		t.Fatalf("got %v docker run commands, want 2", len(runs))
+	}
+	for i, run := range runs {
+		volumes := map[string]bool{}
+		for _, arg := range run {
+			if !strings.HasPrefix(arg, "--volume=") {
+				continue
+			}
+			if volumes[arg] {
+				t.Errorf("instance %v mounts %v more than once", i, arg)
+			}
+			volumes[arg] = true
+		}
+		for _, volume := range topology.Distributions[1-i].PackageCacheVolumes() {
+			if volumes["--volume="+volume] {
+				t.Errorf("instance %v mounts the package cache of the other instance %v", i, volume)
+			}
+		}
+	}
+
+	// The report has the volumes of every instance, once each.
+	seen := map[string]bool{}
+	for _, volume := range report.Docker.Volumes {
+		if seen[volume] {
+			t.Errorf("report has %v more than once", volume)
+		}
+		seen[volume] = true
+	}
+	for _, dist := range topology.Distributions {
+		for _, volume := range dist.PackageCacheVolumes() {
+			if !seen[volume] {
+				t.Errorf("report is missing %v", volume)
+			}
+		}
+	}
+}
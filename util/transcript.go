@@ -0,0 +1,238 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TranscriptEntry is a command in a transcript, with its outcome.
+type TranscriptEntry struct {
+	Name     string        `json:"name"`
+	Args     []string      `json:"args"`
+	Dir      string        `json:"dir,omitempty"`
+	Env      []string      `json:"env,omitempty"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// transcriptRedacted replaces secrets in the output of commands.
+const transcriptRedacted = "<redacted>"
+
+// RecordingExecutor is an Executor which runs commands with another
+// Executor and appends each of them to a transcript file, one JSON
+// object per line, so the transcript is complete even if the test
+// exits early. Secrets returned by credential helpers are redacted,
+// and the transcript is only readable by its owner.
+type RecordingExecutor struct {
+	Executor Executor
+
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewRecordingExecutor will return a RecordingExecutor which runs
+// commands with the executor and records them to a new transcript.
+func NewRecordingExecutor(executor Executor, path string) (*RecordingExecutor, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not create transcript: %v", err)
+	}
+	return &RecordingExecutor{
+		Executor: executor,
+		file:     file,
+	}, nil
+}
+
+// Execute will run the command and record it with its outcome.
+func (r *RecordingExecutor) Execute(command Command) (CommandResult, error) {
+
+	result, err := r.Executor.Execute(command)
+
+	entry := TranscriptEntry{
+		Name:     command.Name,
+		Args:     command.Args,
+		Dir:      command.Dir,
+		Env:      command.Env,
+		Stdout:   result.Stdout,
+		Stderr:   result.Stderr,
+		ExitCode: result.ExitCode,
+		Duration: result.Duration,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if strings.HasPrefix(command.Name, "docker-credential-") && len(command.Args) > 0 && command.Args[0] == "get" {
+		entry.Stdout = redactCredentials(entry.Stdout)
+	}
+
+	data, _ := json.Marshal(entry)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, werr := fmt.Fprintln(r.file, string(data)); werr != nil {
+		log.Errorf("could not record %v: %v", command, werr)
+	}
+
+	return result, err
+}
+
+// redactCredentials will replace the secret in the response of a
+// credential helper, or the whole response if it cannot be decoded.
+func redactCredentials(stdout string) string {
+	response := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(stdout), &response); err != nil {
+		return transcriptRedacted
+	}
+	if _, ok := response["Secret"]; ok {
+		response["Secret"] = transcriptRedacted
+	}
+	data, _ := json.Marshal(response)
+	return string(data)
+}
+
+// Close will close the transcript file.
+func (r *RecordingExecutor) Close() error {
+	return r.file.Close()
+}
+
+// ReplayExecutor is an Executor which returns the outcome of commands
+// from a transcript instead of running them. Each command is matched to
+// the first unused entry with the same name and arguments, or otherwise
+// to the next unused entry with the same name and subcommand, which
+// allows for container names generated from the time of the run.
+// Temporary Docker configuration directories are not compared.
+type ReplayExecutor struct {
+	Entries []TranscriptEntry
+
+	used []bool
+	mu   sync.Mutex
+}
+
+// NewReplayExecutor will return a ReplayExecutor for the transcript.
+func NewReplayExecutor(path string) (*ReplayExecutor, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open transcript: %v", err)
+	}
+	defer file.Close()
+
+	entries := []TranscriptEntry{}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			entry := TranscriptEntry{}
+			if jerr := json.Unmarshal(line, &entry); jerr != nil {
+				return nil, fmt.Errorf("invalid transcript entry %v: %v", len(entries)+1, jerr)
+			}
+			entries = append(entries, entry)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read transcript: %v", err)
+		}
+	}
+
+	return &ReplayExecutor{
+		Entries: entries,
+		used:    make([]bool, len(entries)),
+	}, nil
+}
+
+// next will return the entry for the command and mark it used.
+func (r *ReplayExecutor) next(command Command) (TranscriptEntry, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	args := replayArgs(command.Args)
+	for i, entry := range r.Entries {
+		if !r.used[i] && entry.Name == command.Name && reflect.DeepEqual(replayArgs(entry.Args), args) {
+			r.used[i] = true
+			return entry, nil
+		}
+	}
+
+	subcommand := func(args []string) string {
+		if len(args) == 0 {
+			return ""
+		}
+		return args[0]
+	}
+	for i, entry := range r.Entries {
+		if !r.used[i] && entry.Name == command.Name && subcommand(replayArgs(entry.Args)) == subcommand(args) {
+			r.used[i] = true
+			log.Warnf("Replaying %v for %v", Command{Name: entry.Name, Args: entry.Args}, command)
+			return entry, nil
+		}
+	}
+
+	return TranscriptEntry{}, fmt.Errorf("no command in the transcript matches %v", command)
+}
+
+// replayArgs will return the arguments without --config, which is a
+// temporary directory of credentials created for each run.
+func replayArgs(args []string) []string {
+	filtered := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--config=") {
+			filtered = append(filtered, arg)
+		}
+	}
+	return filtered
+}
+
+// Execute will return the recorded outcome of the command,
+// writing its output when the command is streamed.
+func (r *ReplayExecutor) Execute(command Command) (CommandResult, error) {
+
+	entry, err := r.next(command)
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+
+	if command.Stream {
+		fmt.Fprint(CommandStdout, entry.Stdout)
+		fmt.Fprint(os.Stderr, entry.Stderr)
+	}
+
+	result := CommandResult{
+		Stdout:   entry.Stdout,
+		Stderr:   entry.Stderr,
+		ExitCode: entry.ExitCode,
+		Duration: entry.Duration,
+	}
+	if entry.Error != "" {
+		return result, errors.New(entry.Error)
+	}
+
+	return result, nil
+}
+
+// Remaining will return the number of entries which have not been replayed.
+func (r *ReplayExecutor) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := 0
+	for _, used := range r.used {
+		if !used {
+			remaining++
+		}
+	}
+	return remaining
+}
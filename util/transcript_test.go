@@ -0,0 +1,141 @@
+package util
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestTranscript(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "ansible-role-tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "transcript.jsonl")
+
+	fake := &FakeExecutor{
+		Respond: func(command Command) (CommandResult, error) {
+			if command.Args[0] == "exec" {
+				return CommandResult{Stdout: "syntax error", ExitCode: 4}, errors.New("exit status 4")
+			}
+			return CommandResult{Stdout: "'art-test'\n"}, nil
+		},
+	}
+	recorder, err := NewRecordingExecutor(fake, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor := CommandExecutor
+	defer func() { CommandExecutor = executor }()
+
+	dist := Ubuntu1804
+	dist.CID = "art-test"
+	config := AnsibleConfig{
+		HostPath:     "/home/user/ansible-role-example",
+		RemotePath:   "/etc/ansible/roles/role_under_test",
+		PlaybookFile: "tests/playbook.yml",
+		Quiet:        true,
+	}
+
+	CommandExecutor = recorder
+	recordedRun := dist.DockerCheck()
+	recordedSyntax := dist.RoleSyntaxCheck(&config)
+	recorder.Close()
+
+	replayer, err := NewReplayExecutor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayer.Entries) != len(fake.Commands) {
+		t.Fatalf("got %v entries, want %v", len(replayer.Entries), len(fake.Commands))
+	}
+
+	CommandExecutor = replayer
+	if got := dist.DockerCheck(); got != recordedRun {
+		t.Errorf("replayed DockerCheck returned %v, recorded %v", got, recordedRun)
+	}
+	if got := dist.RoleSyntaxCheck(&config); got != recordedSyntax {
+		t.Errorf("replayed RoleSyntaxCheck returned %v, recorded %v", got, recordedSyntax)
+	}
+	if replayer.Remaining() != 0 {
+		t.Errorf("%v entries were not replayed", replayer.Remaining())
+	}
+
+	if _, err := DockerExec([]string{"ps"}, false); err == nil {
+		t.Error("a command missing from the transcript was replayed")
+	}
+}
+
+func TestTranscriptCredentials(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "ansible-role-tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "transcript.jsonl")
+
+	fake := &FakeExecutor{
+		Respond: func(command Command) (CommandResult, error) {
+			if command.Name == "docker-credential-test" {
+				return CommandResult{Stdout: `{"ServerURL":"registry.local","Username":"user","Secret":"hunter2"}`}, nil
+			}
+			return CommandResult{}, nil
+		},
+	}
+	recorder, err := NewRecordingExecutor(fake, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor, helper := CommandExecutor, CredentialHelper
+	defer func() { CommandExecutor, CredentialHelper = executor, helper }()
+	CredentialHelper = "test"
+
+	CommandExecutor = recorder
+	if err := DockerPullPolicy("registry.local/team/image:1", PullAlways, true); err != nil {
+		t.Fatal(err)
+	}
+	recorder.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("the transcript was created with mode %v, want 0600", mode)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("the secret from the credential helper was recorded")
+	}
+
+	if !strings.Contains(string(data), "--config=") {
+		t.Fatal("the pull was not recorded with a configuration directory")
+	}
+
+	replayer, err := NewReplayExecutor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	CommandExecutor = replayer
+	if err := DockerPullPolicy("registry.local/team/image:1", PullAlways, true); err != nil {
+		t.Fatal(err)
+	}
+	if replayer.Remaining() != 0 {
+		t.Errorf("%v entries were not replayed", replayer.Remaining())
+	}
+}
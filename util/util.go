@@ -1,33 +1,13 @@
 package util
 
 import (
+	"fmt"
 	"net"
 	"os/exec"
-
-	log "github.com/sirupsen/logrus"
 )
 
-var (
-
-	// ansibleplaybook is the path to ansible-playbook.
-	// this will only be used on targeted remotes which
-	// replaces the inventory path when calling
-	// ansible-playbook from the host machine.
-	ansibleplaybook string
-
-	// docker is simply the path to the Docker binary.
-	// this will be located using exec.LookPath().
-	// this must validate to a working binary named
-	// docker in $PATH, otherwise the program will
-	// report a fatal error.
-	docker string
-
-	// dockerFound is a simple boolean which is set
-	// to false by default, it's used in addition to
-	// the docker string above to identify if the
-	// docker binary is found to simplify flow control.
-	dockerFound = false
-)
+// DockerSocket is the socket used to verify Docker is available.
+const DockerSocket = "/var/run/docker.sock"
 
 // AnsibleConfig represents a series of configuration options
 // for an ansible command to be executed.
@@ -35,45 +15,94 @@ type AnsibleConfig struct {
 
 	// HostPath is the path to the directory containing the role
 	// on the host machine, which could be anywhere.
-	HostPath string
+	HostPath string `json:"host_path" yaml:"host_path"`
 
 	// Inventory is the inventory argument in Ansible commands.
 	// in this case we are focusing on inventory files or inline dicts.
 	// Example: 'container_name,' or './tests/inventory.
-	Inventory string
+	Inventory string `json:"inventory" yaml:"inventory"`
 
 	// RemotePath is the path to the roles folder on the container
 	// which should represent the roles folder (ie /etc/ansible/roles)
-	RemotePath string
+	RemotePath string `json:"remote_path" yaml:"remote_path"`
 
 	// ExtraRolesPath is the path to the roles folder on the host which will
 	// be mounted on the container to "/root/.ansible/roles" and available to the playbook
 	// as dependencies. This is a useful workaround for CI/CD environments where the roles
 	// are already downloaded on the host, or if the roles are in private git repos.
-	ExtraRolesPath string
+	ExtraRolesPath string `json:"extra_roles_path" yaml:"extra_roles_path"`
 
 	// LibraryPath is the path to the library folder on the host which will
 	// be mounted on the container to "/root/.ansible/library".
-	LibraryPath string
+	LibraryPath string `json:"library_path" yaml:"library_path"`
 
 	// The path to the requirements file relative to HostPath.
 	// Requirements will not attempt installation if the field
 	// does not have a value (when value == "")
-	RequirementsFile string
+	RequirementsFile string `json:"requirements_file" yaml:"requirements_file"`
+
+	// GalaxyCache is the path to the directory on the host which caches
+	// the roles and collections of the requirements file. It is mounted
+	// to GalaxyCacheMount and requirements are only installed into it once.
+	GalaxyCache string `json:"galaxy_cache" yaml:"galaxy_cache"`
 
 	// PlaybookFile is the path to the playbook located in the
 	// tests file relative to HostPath (ie HostPath/tests/playbook.yml)
-	PlaybookFile string
+	PlaybookFile string `json:"playbook_file" yaml:"playbook_file"`
+
+	// PrepareFile is the path to a playbook relative to HostPath which
+	// prepares the container after requirements are installed and
+	// before the role is tested. It is not tested for idempotence.
+	PrepareFile string `json:"prepare_file" yaml:"prepare_file"`
+
+	// Snapshot is the image the container is saved to after requirements
+	// and prepare have run, see SnapshotPrepare. Snapshots are disabled
+	// when empty.
+	Snapshot string `json:"snapshot" yaml:"snapshot"`
+
+	// Dockerfile is the path to a Dockerfile relative to HostPath which
+	// will be built and used as the image under test. When empty, the
+	// file at DockerfileDefault will be used if it exists.
+	Dockerfile string `json:"dockerfile" yaml:"dockerfile"`
+
+	// Network is the name of a Docker network the container will be
+	// attached to. The container is reachable on the network by Hostname.
+	Network string `json:"network" yaml:"network"`
+
+	// NetworkMode isolates the container from external networks when
+	// set to NetworkNone or NetworkInternal, see NetworkPrepare.
+	NetworkMode string `json:"network_mode" yaml:"network_mode"`
+
+	// Hostname is the hostname of the container, and its
+	// alias on the Network when one is configured.
+	Hostname string `json:"hostname" yaml:"hostname"`
+
+	// ExtraHosts are additional entries for /etc/hosts in the
+	// container in the form accepted by 'docker run --add-host'.
+	ExtraHosts []string `json:"extra_hosts" yaml:"extra_hosts"`
+
+	// Env is additional environment for the container
+	// in the form accepted by 'docker run --env'.
+	Env []string `json:"env" yaml:"env"`
+
+	// PackageCache mounts persistent volumes for the package manager
+	// cache of the distribution, so packages are only downloaded once.
+	PackageCache bool `json:"package_cache" yaml:"package_cache"`
+
+	// Pool is the number of started containers to keep ready for this
+	// configuration, so later runs can take one without waiting for it
+	// to start. Pooling is disabled when zero.
+	Pool int `json:"pool" yaml:"pool"`
 
 	// Remote indicates the playbook will be run on a remote host
 	// likely which is inputted to the inventory field.
-	Remote bool
+	Remote bool `json:"remote" yaml:"remote"`
 
 	// verbose
-	Verbose bool
+	Verbose bool `json:"verbose" yaml:"verbose"`
 
 	// Quiet will determine if all reporting mechanisms are hidden.
-	Quiet bool
+	Quiet bool `json:"quiet" yaml:"quiet"`
 }
 
 // Container is an interface which allows
@@ -87,21 +116,17 @@ type Container interface {
 	RoleTest(config *AnsibleConfig)
 }
 
-func init() {
-	d, e := exec.LookPath("docker")
-	if e != nil {
-		log.Errorln("executable 'docker' was not found in $PATH.")
+// CheckDocker will return an error if the docker binary is not in $PATH
+// or the Docker daemon cannot be connected to. It is called by commands
+// before they use Docker, so the package can be used without it.
+func CheckDocker() error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("executable 'docker' was not found in $PATH")
 	}
 
-	docker = d
-	dockerFound = true
-
-	if dockerFound {
-		c, err := net.Dial("unix", "/var/run/docker.sock")
-		if err != nil {
-			log.Fatalf("unable to connect to docker: %v", err)
-		}
-		defer c.Close()
+	c, err := net.Dial("unix", DockerSocket)
+	if err != nil {
+		return fmt.Errorf("unable to connect to docker: %v", err)
 	}
-
+	return c.Close()
 }
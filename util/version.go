@@ -0,0 +1,121 @@
+package util
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Version is the version of the tool, which is set when building a
+// release with -ldflags "-X github.com/fubarhouse/ansible-role-tester/util.Version=...".
+var Version = "dev"
+
+// ReportSchemaVersion is the version of the schema reports are written in,
+// published in schema/report.schema.json. It is incremented when fields
+// are renamed or removed.
+const ReportSchemaVersion = "1.0"
+
+// Environment describes the versions of the software a test was run with.
+type Environment struct {
+	// ToolVersion is the Version of this tool.
+	ToolVersion string `json:"tool_version" yaml:"tool_version"`
+	// DockerVersion is the version of the Docker server.
+	DockerVersion string `json:"docker_version" yaml:"docker_version"`
+	// AnsibleVersion is the version of Ansible which ran the playbook.
+	AnsibleVersion string `json:"ansible_version" yaml:"ansible_version"`
+	// PythonVersion is the version of Python used by Ansible.
+	PythonVersion string `json:"python_version" yaml:"python_version"`
+	// ImageDigest is the digest of the image the container was started from.
+	ImageDigest string `json:"image_digest" yaml:"image_digest"`
+	// HostOS is the operating system and architecture of the host.
+	HostOS string `json:"host_os" yaml:"host_os"`
+}
+
+// NewEnvironment will return the Environment of the host, without
+// the versions which are only known once a container is running.
+func NewEnvironment() Environment {
+	return Environment{
+		ToolVersion: Version,
+		HostOS:      runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
+// DockerVersion will return the version of the Docker server.
+func DockerVersion() (string, error) {
+	out, err := DockerExec([]string{
+		"version",
+		"--format",
+		"{{.Server.Version}}",
+	}, false)
+	return strings.TrimSpace(out), err
+}
+
+// AnsibleVersion will return the versions of Ansible and Python in
+// the container, or on the host when the container is empty.
+func AnsibleVersion(container string) (string, string, error) {
+	command := Command{Name: "ansible", Args: []string{"--version"}}
+	if container != "" {
+		command = Command{Name: "docker", Args: []string{"exec", container, "ansible", "--version"}}
+	}
+
+	result, err := execute(command)
+	if err != nil {
+		return "", "", err
+	}
+	ansible, python := ParseAnsibleVersion(result.Stdout)
+	return ansible, python, nil
+}
+
+// ParseAnsibleVersion will return the versions of Ansible and Python
+// from the output of 'ansible --version', which names the version on
+// the first line either as 'ansible 2.9.6' or 'ansible [core 2.14.1]'.
+func ParseAnsibleVersion(output string) (string, string) {
+	var ansible, python string
+	for i, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if i == 0 {
+			line = strings.TrimPrefix(line, "ansible")
+			line = strings.Trim(line, " []")
+			ansible = strings.TrimSpace(strings.TrimPrefix(line, "core"))
+		}
+		if strings.HasPrefix(line, "python version =") {
+			fields := strings.Fields(strings.TrimPrefix(line, "python version ="))
+			if len(fields) > 0 {
+				python = fields[0]
+			}
+		}
+	}
+	return ansible, python
+}
+
+// DetectEnvironment will fill the versions of Docker, Ansible and Python
+// and the digest of the image in the Environment of the report. Ansible
+// is detected on the host when the playbook is run remotely, and in the
+// container otherwise. Versions which cannot be detected are left empty.
+func (dist *Distribution) DetectEnvironment(config *AnsibleConfig, report *AnsibleReport) {
+	container := dist.CID
+	if config.Remote {
+		container = ""
+	}
+	report.Environment.ImageDigest = report.Docker.Digest
+	report.Environment.DockerVersion, _ = DockerVersion()
+	report.Environment.AnsibleVersion, report.Environment.PythonVersion, _ = AnsibleVersion(container)
+}
+
+// Printf will print the versions which are known.
+func (environment *Environment) Printf() {
+	fmt.Printf("Tool version: \t\t\t%v\n", environment.ToolVersion)
+	fmt.Printf("Host OS: \t\t\t%v\n", environment.HostOS)
+	if environment.DockerVersion != "" {
+		fmt.Printf("Docker version: \t\t%v\n", environment.DockerVersion)
+	}
+	if environment.AnsibleVersion != "" {
+		fmt.Printf("Ansible version: \t\t%v\n", environment.AnsibleVersion)
+	}
+	if environment.PythonVersion != "" {
+		fmt.Printf("Python version: \t\t%v\n", environment.PythonVersion)
+	}
+	if environment.ImageDigest != "" {
+		fmt.Printf("Image digest: \t\t\t%v\n", environment.ImageDigest)
+	}
+}
@@ -0,0 +1,111 @@
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseAnsibleVersion(t *testing.T) {
+	tests := []struct {
+		output  string
+		ansible string
+		python  string
+	}{
+		{
+			output:  "ansible 2.9.6\n  config file = /etc/ansible/ansible.cfg\n  python version = 3.8.10 (default, Nov 14 2022, 12:59:47) [GCC 9.4.0]\n",
+			ansible: "2.9.6",
+			python:  "3.8.10",
+		},
+		{
+			output:  "ansible [core 2.14.1]\n  config file = None\n  python version = 3.11.2 (main, Mar 13 2023, 12:18:29) [GCC 12.2.0] (/usr/bin/python3)\n  jinja version = 3.1.2\n",
+			ansible: "2.14.1",
+			python:  "3.11.2",
+		},
+		{
+			output: "",
+		},
+	}
+
+	for _, test := range tests {
+		ansible, python := ParseAnsibleVersion(test.output)
+		if ansible != test.ansible || python != test.python {
+			t.Errorf("ParseAnsibleVersion(%q) = %q, %q, want %q, %q", test.output, ansible, python, test.ansible, test.python)
+		}
+	}
+}
+
+// schemaKeys returns the properties of a JSON Schema object
+// in the form parent.child, following local references.
+func schemaKeys(schema, node map[string]interface{}, prefix string) []string {
+	if ref, ok := node["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/definitions/")
+		node = schema["definitions"].(map[string]interface{})[name].(map[string]interface{})
+	}
+	if items, ok := node["items"].(map[string]interface{}); ok {
+		return schemaKeys(schema, items, prefix)
+	}
+
+	keys := []string{}
+	properties, _ := node["properties"].(map[string]interface{})
+	for key, property := range properties {
+		keys = append(keys, prefix+key)
+		keys = append(keys, schemaKeys(schema, property.(map[string]interface{}), prefix+key+".")...)
+	}
+	return keys
+}
+
+// reportKeys returns the keys of a decoded JSON document in the form parent.child.
+func reportKeys(node interface{}, prefix string) []string {
+	keys := []string{}
+	if object, ok := node.(map[string]interface{}); ok {
+		for key, value := range object {
+			keys = append(keys, prefix+key)
+			keys = append(keys, reportKeys(value, prefix+key+".")...)
+		}
+	}
+	if array, ok := node.([]interface{}); ok && len(array) > 0 {
+		keys = append(keys, reportKeys(array[0], prefix)...)
+	}
+	return keys
+}
+
+func TestReportSchema(t *testing.T) {
+	data, err := ioutil.ReadFile("../schema/report.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	version := properties["schema_version"].(map[string]interface{})["const"]
+	if version != ReportSchemaVersion {
+		t.Errorf("schema version is %v, want %v", version, ReportSchemaVersion)
+	}
+
+	report := NewReport(&AnsibleConfig{HostPath: "/nonexistent"})
+	report.Ansible.Instances = []Distribution{Ubuntu1804}
+	report.Stages = []StageResult{{Name: StageStart}}
+	report.Ansible.Idempotence.Changed = []string{"task (host)"}
+	data, err = json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	want := schemaKeys(schema, schema, "")
+	got := reportKeys(decoded, "")
+	sort.Strings(want)
+	sort.Strings(got)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("report keys do not match the schema\ngot:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,162 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// WatchInterval is the default interval between scans of a Watcher.
+	WatchInterval = 500 * time.Millisecond
+
+	// WatchDebounce is the default time a Watcher waits for changes
+	// to settle, so saving several files is reported as one change.
+	WatchDebounce = time.Second
+)
+
+// Watcher polls a directory for changes to the files inside of it.
+// Polling is used so no platform specific notification is required,
+// and roles are small enough for it to be inexpensive.
+type Watcher struct {
+	// Root is the directory to watch.
+	Root string
+
+	// Interval is the time between scans of the directory.
+	Interval time.Duration
+
+	// Debounce is the time without changes to wait for
+	// before changes are returned.
+	Debounce time.Duration
+
+	files map[string]time.Time
+}
+
+// NewWatcher will return a Watcher for the directory
+// which reports changes made after it was created.
+func NewWatcher(root string) (*Watcher, error) {
+
+	w := &Watcher{
+		Root:     root,
+		Interval: WatchInterval,
+		Debounce: WatchDebounce,
+	}
+
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.files = files
+
+	return w, nil
+}
+
+// watchIgnored will return true if the file should not be watched,
+// including hidden directories and editor swap and backup files.
+func watchIgnored(name string, dir bool) bool {
+
+	if dir {
+		return strings.HasPrefix(name, ".") && name != "."
+	}
+
+	for _, suffix := range []string{".swp", ".swx", ".retry", "~"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return strings.HasPrefix(name, ".#")
+}
+
+// scan will return the modification time of every watched file.
+func (w *Watcher) scan() (map[string]time.Time, error) {
+
+	files := map[string]time.Time{}
+	err := filepath.Walk(w.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may be removed while walking.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if watchIgnored(info.Name(), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(w.Root, path)
+			files[rel] = info.ModTime()
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// changes will scan the directory and return the files which
+// have been added, modified or removed since the last scan.
+func (w *Watcher) changes() ([]string, error) {
+
+	files, err := w.scan()
+	if err != nil {
+		return []string{}, err
+	}
+
+	changed := []string{}
+	for file, modified := range files {
+		if previous, ok := w.files[file]; !ok || !previous.Equal(modified) {
+			changed = append(changed, file)
+		}
+	}
+	for file := range w.files {
+		if _, ok := files[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	w.files = files
+
+	return changed, nil
+}
+
+// Wait will block until files have changed and no further changes
+// were made for the debounce period, then return the changed files.
+// Wait returns early with no files when stop is closed.
+func (w *Watcher) Wait(stop <-chan struct{}) ([]string, error) {
+
+	changed := map[string]bool{}
+	var last time.Time
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return []string{}, nil
+		case now := <-ticker.C:
+			files, err := w.changes()
+			if err != nil {
+				return []string{}, err
+			}
+			for _, file := range files {
+				changed[file] = true
+			}
+			if len(files) > 0 {
+				last = now
+			}
+			if len(changed) > 0 && now.Sub(last) >= w.Debounce {
+				result := []string{}
+				for file := range changed {
+					result = append(result, file)
+				}
+				sort.Strings(result)
+				return result, nil
+			}
+		}
+	}
+}
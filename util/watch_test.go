@@ -0,0 +1,69 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatcherWait(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, modified time.Time) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Modification times are set explicitly, as the
+		// resolution of the file system may be coarse.
+		os.Chtimes(path, modified, modified)
+	}
+	start := time.Now().Add(-time.Hour)
+	write("tasks/main.yml", start)
+
+	watcher, err := NewWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher.Interval = 10 * time.Millisecond
+	watcher.Debounce = 200 * time.Millisecond
+
+	// Changes made within the debounce period are returned together,
+	// once no changes have been made for the debounce period.
+	done := make(chan time.Time, 1)
+	go func() {
+		write("tasks/main.yml", start.Add(time.Minute))
+		time.Sleep(50 * time.Millisecond)
+		write("defaults/main.yml", start)
+		write("tasks/.main.yml.swp", start)
+		write(".git/index", start)
+		done <- time.Now()
+	}()
+
+	changed, err := watcher.Wait(make(chan struct{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changes are timed by the scan which found them, up to an interval late.
+	if waited, want := time.Since(<-done), watcher.Debounce-watcher.Interval; waited < want {
+		t.Errorf("changes were returned %v after the last change, want at least %v", waited, want)
+	}
+	if want := []string{filepath.Join("defaults", "main.yml"), filepath.Join("tasks", "main.yml")}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("Wait() = %v, want %v", changed, want)
+	}
+
+	// Wait returns no changes once it is stopped.
+	stop := make(chan struct{})
+	close(stop)
+	if changed, err := watcher.Wait(stop); err != nil || len(changed) != 0 {
+		t.Errorf("Wait() = %v, %v after stop, want no changes", changed, err)
+	}
+}